@@ -0,0 +1,175 @@
+package boltdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// checksumExt is the extension of the sidecar file holding the SHA-256 checksum of a backup,
+// in the format used by sha256sum.
+const checksumExt = ".sha256"
+
+// Backup writes a consistent snapshot of the database to w, from a read transaction,
+// so it can run while the repository is in use.
+func (r *repo) Backup(w io.Writer) (int64, error) {
+	if r == nil || r.d == nil {
+		return 0, errNotOpen
+	}
+	var n int64
+	err := r.d.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	if err != nil {
+		return n, errors.Annotatef(err, "unable to write backup")
+	}
+	return n, nil
+}
+
+// BackupToFile writes a snapshot of the database to the file at path. The file is replaced atomically,
+// so an interrupted backup never leaves a partial file behind.
+// If withChecksum is set, the SHA-256 checksum of the backup is written to a sidecar file with the ".sha256" extension.
+func (r *repo) BackupToFile(path string, withChecksum bool) (int64, error) {
+	if r == nil || r.d == nil {
+		return 0, errNotOpen
+	}
+	h := sha256.New()
+	var n int64
+	err := writeFileAtomic(path, r.fileMode, func(w io.Writer) error {
+		var err error
+		n, err = r.Backup(io.MultiWriter(w, h))
+		return err
+	})
+	if err != nil || !withChecksum {
+		return n, err
+	}
+	sum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(path))
+	err = writeFileAtomic(path+checksumExt, r.fileMode, func(w io.Writer) error {
+		_, err := io.WriteString(w, sum)
+		return err
+	})
+	return n, err
+}
+
+// writeFileAtomic writes the file at path using a temporary file in the same folder, which is renamed
+// over path only after all the data has been written and synced to disk.
+func writeFileAtomic(path string, mode os.FileMode, writeFn func(io.Writer) error) error {
+	if mode == 0 {
+		mode = 0600
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Annotatef(err, "unable to create temporary file")
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err = writeFn(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Annotatef(err, "unable to sync %s", tmp)
+	}
+	if err = f.Close(); err != nil {
+		return errors.Annotatef(err, "unable to close %s", tmp)
+	}
+	if err = os.Chmod(tmp, mode); err != nil {
+		return errors.Annotatef(err, "unable to change mode of %s", tmp)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return errors.Annotatef(err, "unable to move %s to %s", tmp, path)
+	}
+	return nil
+}
+
+// validateSnapshot checks that the file at path is a consistent boltdb database,
+// using a storage schema version which is not newer than the current one.
+func validateSnapshot(path string, root []byte) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return errors.Annotatef(err, "invalid snapshot")
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		// NOTE: the check channel needs to be drained, otherwise its goroutine outlives the transaction
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = errors.Annotatef(err, "inconsistent snapshot")
+			}
+		}
+		if checkErr != nil {
+			return checkErr
+		}
+		rb := tx.Bucket(root)
+		if rb == nil {
+			return errors.Newf("invalid snapshot, missing root bucket %s", root)
+		}
+		if v := schemaVersion(rb); v > currentSchemaVersion {
+			return ErrorSchemaVersion(v, currentSchemaVersion)
+		}
+		return nil
+	})
+}
+
+// Restore replaces the database of the repository described by conf with the snapshot read from rd.
+// The snapshot is validated before replacing the existing database, which must not be opened by the
+// current process. If the snapshot uses an older storage schema version, it needs to be migrated after restoring.
+func Restore(conf Config, rd io.Reader) error {
+	if conf.ReadOnly {
+		return ErrorReadOnly
+	}
+	r, err := New(conf)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".restore-*")
+	if err != nil {
+		return errors.Annotatef(err, "unable to create temporary file")
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	_, err = io.Copy(f, rd)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Annotatef(err, "unable to write snapshot")
+	}
+	if err = validateSnapshot(tmp, r.root); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp, r.fileMode); err != nil {
+		return errors.Annotatef(err, "unable to change mode of %s", tmp)
+	}
+
+	// NOTE: we hold the lock of the existing database while replacing it, so we don't pull it from under
+	// another process using it. The Timeout from the Config limits how long we wait for it.
+	if _, err = os.Stat(r.path); err == nil {
+		db, err := r.openDB()
+		if err != nil {
+			return errors.Annotatef(err, "unable to lock %s", r.path)
+		}
+		defer db.Close()
+	}
+	if err = os.Rename(tmp, r.path); err != nil {
+		return errors.Annotatef(err, "unable to replace %s", r.path)
+	}
+	return nil
+}
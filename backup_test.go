@@ -0,0 +1,111 @@
+package boltdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_repo_Backup(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems)
+	t.Cleanup(r.Close)
+
+	buf := bytes.Buffer{}
+	n, err := r.Backup(&buf)
+	if err != nil {
+		t.Fatalf("Backup() error = %s", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Backup() = %d, but wrote %d bytes", n, buf.Len())
+	}
+
+	conf := Config{Path: t.TempDir()}
+	if err = Restore(conf, &buf); err != nil {
+		t.Fatalf("Restore() error = %s", err)
+	}
+	restored, _ := New(conf)
+	if err = restored.Open(); err != nil {
+		t.Fatalf("Open() of restored db error = %s", err)
+	}
+	t.Cleanup(restored.Close)
+	for _, it := range mockItems {
+		if vocab.IsIRI(it) {
+			continue
+		}
+		if _, err = restored.Load(it.GetLink()); err != nil {
+			t.Errorf("Load() of %s from restored db error = %s", it.GetLink(), err)
+		}
+	}
+}
+
+func Test_repo_BackupToFile(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems)
+	t.Cleanup(r.Close)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backup.bdb")
+	if _, err := r.BackupToFile(path, false); err != nil {
+		t.Fatalf("BackupToFile() error = %s", err)
+	}
+	if _, err := os.Stat(path + checksumExt); !os.IsNotExist(err) {
+		t.Errorf("BackupToFile() without checksum created sidecar file")
+	}
+
+	n, err := r.BackupToFile(path, true)
+	if err != nil {
+		t.Fatalf("BackupToFile() error = %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read backup: %s", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("BackupToFile() = %d, but the file has %d bytes", n, len(data))
+	}
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:]) + "  backup.bdb\n"
+	got, err := os.ReadFile(path + checksumExt)
+	if err != nil {
+		t.Fatalf("unable to read checksum: %s", err)
+	}
+	if string(got) != want {
+		t.Errorf("BackupToFile() checksum %s", cmp.Diff(want, string(got)))
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("BackupToFile() left temporary file %s behind", e.Name())
+		}
+	}
+}
+
+func TestRestore_Invalid(t *testing.T) {
+	conf := Config{Path: t.TempDir()}
+	w := mockRepo(t, fields{path: conf.Path}, withOpenRoot, withBootstrap, withMockItems)
+	w.Close()
+
+	err := Restore(conf, strings.NewReader("not a boltdb file"))
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid snapshot") {
+		t.Errorf("Restore() error = %v, want an invalid snapshot error", err)
+	}
+
+	r, _ := New(conf)
+	if err = r.Open(); err != nil {
+		t.Fatalf("Open() after failed restore error = %s", err)
+	}
+	t.Cleanup(r.Close)
+	if _, err = r.Load("https://example.com/1"); err != nil {
+		t.Errorf("Load() after failed restore error = %s", err)
+	}
+	if err = Restore(Config{Path: conf.Path, ReadOnly: true}, strings.NewReader("")); !errors.Is(err, ErrorReadOnly) {
+		t.Errorf("Restore() on read-only config error = %v, want %v", err, ErrorReadOnly)
+	}
+}
@@ -11,11 +11,14 @@ func Bootstrap(conf Config) error {
 	if conf.Path == "" {
 		return os.ErrNotExist
 	}
+	if conf.ReadOnly {
+		return ErrorReadOnly
+	}
 	r, err := New(conf)
 	if err != nil {
 		return err
 	}
-	db, err := bolt.Open(r.path, 0600, bolt.DefaultOptions)
+	db, err := r.openDB()
 	if err != nil {
 		return err
 	}
@@ -28,7 +31,7 @@ func bootstrap(db *bolt.DB, root []byte) error {
 		return errNotOpen
 	}
 	return db.Update(func(tx *bolt.Tx) error {
-		root, err := tx.CreateBucketIfNotExists(root)
+		root, err := createRootBucket(tx, root)
 		if err != nil {
 			return errors.Annotatef(err, "could not create root bucket")
 		}
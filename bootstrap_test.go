@@ -38,6 +38,15 @@ func TestBootstrap(t *testing.T) {
 			name: "temp",
 			arg:  Config{Path: filepath.Join(t.TempDir())},
 		},
+		{
+			name:    "read-only",
+			arg:     Config{Path: t.TempDir(), ReadOnly: true},
+			wantErr: ErrorReadOnly,
+		},
+		{
+			name: "with file mode",
+			arg:  Config{Path: t.TempDir(), FileMode: 0640},
+		},
 		{
 			name:    "deeper than forbidden",
 			arg:     Config{Path: filepath.Join(forbiddenPath, "should-fail")},
@@ -58,6 +67,12 @@ func TestBootstrap(t *testing.T) {
 			if tt.wantErr != nil {
 				return
 			}
+			if tt.arg.FileMode != 0 {
+				path, _ := Path(tt.arg)
+				if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != tt.arg.FileMode {
+					t.Errorf("Bootstrap() created file with mode %v, want %v", fi.Mode().Perm(), tt.arg.FileMode)
+				}
+			}
 
 			ff := fields{
 				path: tt.arg.Path,
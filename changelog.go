@@ -0,0 +1,193 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// NOTE: when the changelog is enabled, every change is appended to the __changelog bucket of the root
+// bucket, in the same transaction as the change itself. The keys are the big endian values of the bucket's
+// sequence, so they're monotonic and survive restarts.
+const changelogBucket = "__changelog"
+
+// NOTE: the __changelog_complete key of the root bucket marks a changelog which has been enabled while the store
+// was empty, and holds all the changes made since. It's removed by the changes which don't get logged.
+const changelogCompleteKey = "__changelog_complete"
+
+// Change is an entry of the changelog.
+// For the objects, collections and metadata the IRI identifies the changed item, and for the OAuth2 data the
+// Bucket and the Key identify the changed value.
+type Change struct {
+	Seq        uint64
+	Time       time.Time
+	Op         Operation
+	IRI        vocab.IRI `json:",omitempty"`
+	Collection vocab.IRI `json:",omitempty"`
+	Bucket     string    `json:",omitempty"`
+	Key        string    `json:",omitempty"`
+}
+
+// ErrorChangesTruncated is returned by ReadChanges when some of the changes following the requested sequence
+// have already been removed from the changelog.
+var ErrorChangesTruncated = errors.Newf("the changelog has been truncated past the requested sequence")
+
+// logChange appends c to the changelog, and trims it to the configured retention.
+func (r *repo) logChange(root *bolt.Bucket, c Change) error {
+	if !r.changelog {
+		return changelogIncomplete(root)
+	}
+	cb, err := root.CreateBucketIfNotExists([]byte(changelogBucket))
+	if err != nil {
+		return errors.Annotatef(err, "could not create changelog bucket")
+	}
+	if c.Seq, err = cb.NextSequence(); err != nil {
+		return err
+	}
+	c.Time = time.Now().UTC()
+	raw, err := r.encode(c)
+	if err != nil {
+		return errors.Annotatef(err, "could not marshal change")
+	}
+	if err = cb.Put(itob(c.Seq), raw); err != nil {
+		return errors.Annotatef(err, "could not store change %d", c.Seq)
+	}
+	if r.changelogRetention > 0 && c.Seq > uint64(r.changelogRetention) {
+		return truncateChanges(cb, c.Seq-uint64(r.changelogRetention))
+	}
+	return nil
+}
+
+// startChangelog marks the changelog as complete, if it's enabled on an empty store.
+func (r *repo) startChangelog(db *bolt.DB) error {
+	if !r.changelog || db.IsReadOnly() {
+		return nil
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil || root.Bucket([]byte(changelogBucket)) != nil || !isEmptyStore(root) {
+			return nil
+		}
+		if _, err := root.CreateBucket([]byte(changelogBucket)); err != nil {
+			return errors.Annotatef(err, "could not create changelog bucket")
+		}
+		return root.Put([]byte(changelogCompleteKey), []byte{1})
+	})
+}
+
+// changelogIncomplete removes the mark of a complete changelog, for changes which don't get logged.
+func changelogIncomplete(root *bolt.Bucket) error {
+	if root.Get([]byte(changelogCompleteKey)) == nil {
+		return nil
+	}
+	return root.Delete([]byte(changelogCompleteKey))
+}
+
+// isEmptyStore returns true if the root bucket doesn't hold any objects, metadata or OAuth2 data.
+func isEmptyStore(root *bolt.Bucket) bool {
+	empty := true
+	_ = root.ForEachBucket(func(name []byte) error {
+		switch string(name) {
+		case changelogBucket, indexBucket:
+		case clientsBucket, authorizeBucket, accessBucket, refreshBucket:
+			if k, _ := root.Bucket(name).Cursor().First(); k != nil {
+				empty = false
+			}
+		default:
+			empty = false
+		}
+		return nil
+	})
+	return empty
+}
+
+// isChangelogComplete returns true if the changelog holds all the changes made since the store was empty.
+func (r *repo) isChangelogComplete() (bool, error) {
+	complete := false
+	err := r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return ErrorInvalidRoot(r.root)
+		}
+		complete = root.Get([]byte(changelogCompleteKey)) != nil
+		return nil
+	})
+	return complete, err
+}
+
+// truncateChanges removes the changes with sequences lower or equal to upTo.
+func truncateChanges(cb *bolt.Bucket, upTo uint64) error {
+	c := cb.Cursor()
+	for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= upTo; k, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return errors.Annotatef(err, "could not remove old change")
+		}
+	}
+	return nil
+}
+
+// ReadChanges returns, in order, at most limit changes following the since sequence.
+// A limit lower than 1 returns all of them. Consumers can resume reading from the Seq of the last change received.
+func (r *repo) ReadChanges(since uint64, limit int) ([]Change, error) {
+	if r == nil || r.d == nil {
+		return nil, errNotOpen
+	}
+	var changes []Change
+	err := r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return ErrorInvalidRoot(r.root)
+		}
+		var err error
+		changes, err = r.readChanges(root, since, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// readChanges returns, from the changelog of the root bucket, at most limit changes following the since sequence.
+func (r *repo) readChanges(root *bolt.Bucket, since uint64, limit int) ([]Change, error) {
+	changes := make([]Change, 0)
+	cb := root.Bucket([]byte(changelogBucket))
+	if cb == nil {
+		return changes, nil
+	}
+	c := cb.Cursor()
+	first, _ := c.First()
+	if (first == nil && cb.Sequence() > since) || (first != nil && binary.BigEndian.Uint64(first) > since+1) {
+		return nil, ErrorChangesTruncated
+	}
+	for k, raw := c.Seek(itob(since + 1)); k != nil && (limit < 1 || len(changes) < limit); k, raw = c.Next() {
+		ch := Change{}
+		if err := r.decode(raw, &ch); err != nil {
+			return nil, errors.Annotatef(err, "could not unmarshal change %d", binary.BigEndian.Uint64(k))
+		}
+		changes = append(changes, ch)
+	}
+	return changes, nil
+}
+
+// TruncateChanges removes from the changelog all the changes up to, and including, the upTo sequence.
+// It's meant to be called once all the consumers have processed them.
+func (r *repo) TruncateChanges(upTo uint64) error {
+	if r == nil || r.d == nil {
+		return errNotOpen
+	}
+	return r.update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return ErrorInvalidRoot(r.root)
+		}
+		cb := root.Bucket([]byte(changelogBucket))
+		if cb == nil {
+			return nil
+		}
+		return truncateChanges(cb, upTo)
+	})
+}
@@ -0,0 +1,155 @@
+package boltdb
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/openshift/osin"
+)
+
+func withChangelog(retention int) initFn {
+	return func(t *testing.T, r *repo) *repo {
+		r.changelog = true
+		r.changelogRetention = retention
+		if r.d != nil {
+			if err := r.startChangelog(r.d); err != nil {
+				t.Fatalf("unable to start changelog: %s", err)
+			}
+		}
+		return r
+	}
+}
+
+func Test_repo_ReadChanges(t *testing.T) {
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	colIRI := vocab.IRI("https://example.com/outbox")
+
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withChangelog(0))
+	t.Cleanup(r.Close)
+
+	if _, err := r.Save(note); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if err := r.AddTo(colIRI, note); err != nil {
+		t.Fatalf("AddTo() error = %s", err)
+	}
+	if err := r.RemoveFrom(colIRI, note); err != nil {
+		t.Fatalf("RemoveFrom() error = %s", err)
+	}
+	if err := r.Delete(note); err != nil {
+		t.Fatalf("Delete() error = %s", err)
+	}
+	if err := r.SaveClient(&osin.DefaultClient{Id: "client"}); err != nil {
+		t.Fatalf("SaveClient() error = %s", err)
+	}
+	if err := r.RemoveClient("client"); err != nil {
+		t.Fatalf("RemoveClient() error = %s", err)
+	}
+
+	all := []Change{
+		{Seq: 1, Op: OpSave, IRI: note.ID},
+		{Seq: 2, Op: OpAddTo, IRI: note.ID, Collection: colIRI},
+		{Seq: 3, Op: OpRemoveFrom, IRI: note.ID, Collection: colIRI},
+		{Seq: 4, Op: OpDelete, IRI: note.ID},
+		{Seq: 5, Op: OpSave, Bucket: clientsBucket, Key: "client"},
+		{Seq: 6, Op: OpDelete, Bucket: clientsBucket, Key: "client"},
+	}
+	ignoreTime := cmpopts.IgnoreFields(Change{}, "Time")
+	tests := []struct {
+		name  string
+		since uint64
+		limit int
+		want  []Change
+	}{
+		{
+			name: "all",
+			want: all,
+		},
+		{
+			name:  "with limit",
+			limit: 2,
+			want:  all[:2],
+		},
+		{
+			name:  "since",
+			since: 4,
+			want:  all[4:],
+		},
+		{
+			name:  "up to date",
+			since: 6,
+			want:  []Change{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ReadChanges(tt.since, tt.limit)
+			if err != nil {
+				t.Fatalf("ReadChanges() error = %s", err)
+			}
+			if !cmp.Equal(got, tt.want, ignoreTime) {
+				t.Errorf("ReadChanges() %s", cmp.Diff(tt.want, got, ignoreTime))
+			}
+		})
+	}
+}
+
+func Test_repo_ReadChanges_SavedCollectionItems(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withChangelog(0))
+	t.Cleanup(r.Close)
+
+	col := &vocab.OrderedCollection{
+		ID:           "https://example.com/outbox",
+		Type:         vocab.OrderedCollectionType,
+		OrderedItems: vocab.ItemCollection{vocab.IRI("https://example.com/1"), vocab.IRI("https://example.com/2")},
+	}
+	if _, err := r.Save(col); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+
+	want := []Change{
+		{Seq: 1, Op: OpAddTo, IRI: "https://example.com/1", Collection: col.ID},
+		{Seq: 2, Op: OpAddTo, IRI: "https://example.com/2", Collection: col.ID},
+		{Seq: 3, Op: OpSave, IRI: col.ID},
+	}
+	ignoreTime := cmpopts.IgnoreFields(Change{}, "Time")
+	got, err := r.ReadChanges(0, 0)
+	if err != nil {
+		t.Fatalf("ReadChanges() error = %s", err)
+	}
+	if !cmp.Equal(got, want, ignoreTime) {
+		t.Errorf("ReadChanges() %s", cmp.Diff(want, got, ignoreTime))
+	}
+}
+
+func Test_repo_TruncateChanges(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withChangelog(3))
+	t.Cleanup(r.Close)
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.Save(&vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}); err != nil {
+			t.Fatalf("Save() error = %s", err)
+		}
+	}
+	// NOTE: the retention keeps only the last 3 changes
+	if _, err := r.ReadChanges(0, 0); !errors.Is(err, ErrorChangesTruncated) {
+		t.Errorf("ReadChanges() of removed changes error = %v, want %v", err, ErrorChangesTruncated)
+	}
+	got, err := r.ReadChanges(2, 0)
+	if err != nil || len(got) != 3 || got[0].Seq != 3 {
+		t.Errorf("ReadChanges() after retention = %v, %v", got, err)
+	}
+
+	if err = r.TruncateChanges(4); err != nil {
+		t.Fatalf("TruncateChanges() error = %s", err)
+	}
+	if _, err = r.ReadChanges(3, 0); !errors.Is(err, ErrorChangesTruncated) {
+		t.Errorf("ReadChanges() of truncated changes error = %v, want %v", err, ErrorChangesTruncated)
+	}
+	if got, err = r.ReadChanges(4, 0); err != nil || len(got) != 1 || got[0].Seq != 5 {
+		t.Errorf("ReadChanges() after truncation = %v, %v", got, err)
+	}
+}
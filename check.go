@@ -0,0 +1,241 @@
+package boltdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ProblemKind is the class of an inconsistency found by Check.
+type ProblemKind string
+
+const (
+	// ProblemMissingRaw is a bucket which doesn't hold an object, nor metadata, nor other items.
+	ProblemMissingRaw ProblemKind = "missing-raw"
+	// ProblemUndecodable is a stored value which can't be decoded.
+	ProblemUndecodable ProblemKind = "undecodable"
+	// ProblemDanglingMember is a collection member pointing to a local object which doesn't exist.
+	ProblemDanglingMember ProblemKind = "dangling-member"
+	// ProblemTotalItems is a collection having a TotalItems different from its number of members.
+	ProblemTotalItems ProblemKind = "total-items"
+	// ProblemOrphanRefresh is a refresh token pointing to an access token which doesn't exist.
+	ProblemOrphanRefresh ProblemKind = "orphan-refresh"
+)
+
+// Problem is an inconsistency found by Check. The Path is the path of the bucket, or the key for the OAuth2 data.
+type Problem struct {
+	Kind     ProblemKind
+	Path     string
+	Detail   string
+	Repaired bool
+
+	fix func(root *bolt.Bucket) error
+}
+
+// CheckReport lists the inconsistencies found by Check, or the ones found and fixed by Repair.
+type CheckReport struct {
+	Repair   bool
+	Problems []Problem
+}
+
+// Check walks all the buckets of the database described by conf, and reports the inconsistencies found.
+func Check(conf Config) (CheckReport, error) {
+	return check(conf, false)
+}
+
+// Repair runs the same checks as Check, and fixes the inconsistencies that can be fixed safely:
+// it drops the dangling collection members, recounts the collection totals, and removes the orphan refresh tokens.
+// The fixes are not appended to the changelog, so the replicas of a repaired repository need to be bootstrapped again.
+func Repair(conf Config) (CheckReport, error) {
+	return check(conf, true)
+}
+
+func check(conf Config, repair bool) (CheckReport, error) {
+	report := CheckReport{Repair: repair}
+	if conf.Path == "" {
+		return report, os.ErrNotExist
+	}
+	if repair && conf.ReadOnly {
+		return report, ErrorReadOnly
+	}
+	conf.ReadOnly = !repair
+	r, err := New(conf)
+	if err != nil {
+		return report, err
+	}
+	db, err := r.openDB()
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	fn := func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return ErrorInvalidRoot(r.root)
+		}
+		report.Problems = append(r.checkItemBuckets(root), r.checkOAuthBuckets(root)...)
+		if !repair {
+			return nil
+		}
+		// NOTE: the fixes are applied after the walk, as bolt doesn't allow changing a bucket while iterating it
+		repaired := false
+		for i, p := range report.Problems {
+			if p.fix == nil {
+				continue
+			}
+			if err := p.fix(root); err != nil {
+				return errors.Annotatef(err, "unable to repair %s %s", p.Kind, p.Path)
+			}
+			report.Problems[i].Repaired = true
+			repaired = true
+		}
+		if !repaired {
+			return nil
+		}
+		return changelogIncomplete(root)
+	}
+	if repair {
+		err = db.Update(fn)
+	} else {
+		err = db.View(fn)
+	}
+	return report, err
+}
+
+func hasItemBuckets(b *bolt.Bucket) bool {
+	found := false
+	_ = b.ForEachBucket(func(k []byte) error {
+		found = found || !isReservedKey(k)
+		return nil
+	})
+	return found
+}
+
+// isLocal returns true if the iri belongs to a host which has objects stored in the root bucket.
+func isLocal(root *bolt.Bucket, iri vocab.IRI) bool {
+	path := itemBucketPath(iri)
+	if len(path) == 0 {
+		return false
+	}
+	host, _, _ := bytes.Cut(path, pathSeparator)
+	return root.Bucket(host) != nil
+}
+
+func objectExists(root *bolt.Bucket, iri vocab.IRI) bool {
+	b, remainder, err := descendInBucket(root, itemBucketPath(iri), false)
+	return err == nil && len(remainder) == 0 && b.Get([]byte(objectKey)) != nil
+}
+
+func (r *repo) checkItemBuckets(root *bolt.Bucket) []Problem {
+	problems := make([]Problem, 0)
+	_ = walkItemBuckets(root, func(path [][]byte, b *bolt.Bucket) error {
+		p := string(bytes.Join(path, pathSeparator))
+		raw := b.Get([]byte(objectKey))
+		if raw == nil {
+			hasItems := b.Bucket([]byte(itemsBucket)) != nil || b.Bucket([]byte(historyBucket)) != nil
+			if b.Get([]byte(metaDataKey)) == nil && (hasItems || !hasItemBuckets(b)) {
+				problems = append(problems, Problem{Kind: ProblemMissingRaw, Path: p})
+			}
+			return nil
+		}
+		col, err := r.decodeItem(raw)
+		if err != nil {
+			problems = append(problems, Problem{Kind: ProblemUndecodable, Path: p, Detail: err.Error()})
+			return nil
+		}
+		if !vocab.IsCollection(col) {
+			return nil
+		}
+		colIRI := col.GetLink()
+		members := collectionMembers(b)
+		for _, it := range members {
+			iri := it.GetLink()
+			if !isLocal(root, iri) || objectExists(root, iri) {
+				continue
+			}
+			problems = append(problems, Problem{
+				Kind:   ProblemDanglingMember,
+				Path:   p,
+				Detail: string(iri),
+				fix: func(root *bolt.Bucket) error {
+					b := bucketAtPath(root, path)
+					removed, err := removeFromCollectionBucket(b, iri)
+					if err != nil {
+						return err
+					}
+					if removed {
+						if err = r.decrementCollectionTotal(b, 1); err != nil {
+							return err
+						}
+					}
+					return removeMembership(root, colIRI, iri)
+				},
+			})
+		}
+		var total, inline uint
+		_ = onCollectionHeader(col, func(items *vocab.ItemCollection, t *uint) {
+			total, inline = *t, uint(len(*items))
+		})
+		if count := inline + uint(len(members)); count != total {
+			problems = append(problems, Problem{
+				Kind:   ProblemTotalItems,
+				Path:   p,
+				Detail: fmt.Sprintf("TotalItems is %d, but the collection has %d items", total, count),
+				fix: func(root *bolt.Bucket) error {
+					b := bucketAtPath(root, path)
+					col, err := r.loadRawItemFromBucket(b)
+					if err != nil {
+						return err
+					}
+					members := uint(len(collectionMembers(b)))
+					_ = onCollectionHeader(col, func(items *vocab.ItemCollection, t *uint) {
+						*t = uint(len(*items)) + members
+					})
+					return r.saveRawItem(col, b)
+				},
+			})
+		}
+		return nil
+	})
+	return problems
+}
+
+func (r *repo) checkOAuthBuckets(root *bolt.Bucket) []Problem {
+	problems := make([]Problem, 0)
+	for _, ob := range osinBuckets {
+		b := root.Bucket([]byte(ob.bucket))
+		if b == nil {
+			continue
+		}
+		_ = b.ForEach(func(k, raw []byte) error {
+			v := ob.newFn()
+			if err := r.decode(raw, v); err != nil {
+				problems = append(problems, Problem{Kind: ProblemUndecodable, Path: ob.bucket + "/" + string(k), Detail: err.Error()})
+				return nil
+			}
+			rf, ok := v.(*ref)
+			if !ok {
+				return nil
+			}
+			if ab := root.Bucket([]byte(accessBucket)); ab != nil && ab.Get([]byte(rf.Access)) != nil {
+				return nil
+			}
+			key := bytes.Clone(k)
+			problems = append(problems, Problem{
+				Kind:   ProblemOrphanRefresh,
+				Path:   refreshBucket + "/" + string(key),
+				Detail: rf.Access,
+				fix: func(root *bolt.Bucket) error {
+					return root.Bucket([]byte(refreshBucket)).Delete(key)
+				},
+			})
+			return nil
+		})
+	}
+	return problems
+}
@@ -0,0 +1,81 @@
+package boltdb
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withInconsistencies(t *testing.T, r *repo) *repo {
+	err := r.d.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if _, _, err := descendInBucket(root, []byte("example.com/empty"), true); err != nil {
+			return err
+		}
+		b, _, err := descendInBucket(root, []byte("example.com/followers"), false)
+		if err != nil {
+			return err
+		}
+		if _, err = appendToCollectionBucket(b, "https://example.com/missing"); err != nil {
+			return err
+		}
+		raw, err := r.encode(ref{Access: "missing"})
+		if err != nil {
+			return err
+		}
+		return root.Bucket([]byte(refreshBucket)).Put([]byte("orphan"), raw)
+	})
+	if err != nil {
+		t.Errorf("unable to create inconsistencies: %s", err)
+	}
+	return r
+}
+
+func TestCheck(t *testing.T) {
+	conf := Config{Path: t.TempDir()}
+	w := mockRepo(t, fields{path: conf.Path}, withOpenRoot, withBootstrap, withMockItems, withOrderedCollectionHavingItems, withInconsistencies)
+	w.Close()
+
+	missingRaw := Problem{Kind: ProblemMissingRaw, Path: "example.com/empty"}
+	want := []Problem{
+		missingRaw,
+		{Kind: ProblemDanglingMember, Path: "example.com/followers", Detail: "https://example.com/missing"},
+		{Kind: ProblemTotalItems, Path: "example.com/followers", Detail: "TotalItems is 1, but the collection has 2 items"},
+		{Kind: ProblemOrphanRefresh, Path: "refresh/orphan", Detail: "missing"},
+	}
+	ignoreFix := cmpopts.IgnoreUnexported(Problem{})
+
+	report, err := Check(conf)
+	if err != nil {
+		t.Fatalf("Check() error = %s", err)
+	}
+	if !cmp.Equal(report.Problems, want, ignoreFix) {
+		t.Errorf("Check() problems %s", cmp.Diff(want, report.Problems, ignoreFix))
+	}
+
+	report, err = Repair(conf)
+	if err != nil {
+		t.Fatalf("Repair() error = %s", err)
+	}
+	for _, p := range report.Problems {
+		if p.Repaired == (p.Kind == ProblemMissingRaw) {
+			t.Errorf("Repair() %s %s repaired = %t", p.Kind, p.Path, p.Repaired)
+		}
+	}
+
+	report, err = Check(conf)
+	if err != nil {
+		t.Fatalf("Check() after Repair() error = %s", err)
+	}
+	if want = []Problem{missingRaw}; !cmp.Equal(report.Problems, want, ignoreFix) {
+		t.Errorf("Check() after Repair() problems %s", cmp.Diff(want, report.Problems, ignoreFix))
+	}
+}
+
+func TestRepair_ReadOnly(t *testing.T) {
+	if _, err := Repair(Config{Path: t.TempDir(), ReadOnly: true}); err != ErrorReadOnly {
+		t.Errorf("Repair() error = %v, want %v", err, ErrorReadOnly)
+	}
+}
@@ -0,0 +1,316 @@
+// Command boltap is an administration tool for the BoltDB storage of GoActivitypub.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	boltdb "github.com/go-ap/storage-boltdb"
+	"github.com/openshift/osin"
+)
+
+const usage = `Usage: %s [-path DIR] [-timeout DURATION] [-codec json|binary] [-compression none|flate|gzip]
+	[-dict FILE] [-key-file FILE] COMMAND [ARGS]
+
+Commands:
+  bootstrap                      create the database
+  clean                          remove the database
+  ls [IRI]                       list the objects stored under IRI
+  get IRI                        print the object as JSON
+  meta IRI                       print the metadata of the object as JSON
+  put IRI < FILE                 save the JSON object read from stdin
+  add-to COLLECTION IRI          add IRI to COLLECTION
+  rm IRI                         delete the object
+  backup FILE                    write a snapshot of the database, and its checksum, to FILE
+  compact [FILE]                 compact the database to FILE, or in place
+  fsck [-repair]                 check the consistency of the database
+  clients list                   list the OAuth2 clients
+  clients add ID SECRET URI      add an OAuth2 client
+  clients remove ID              remove an OAuth2 client
+
+The encryption key can also be passed, hex encoded, in the BOLTAP_ENCRYPTION_KEY environment variable.
+
+Options:
+`
+
+// readOnly are the commands which don't change the database, which can run against a live instance.
+var readOnly = map[string]bool{"ls": true, "get": true, "meta": true, "backup": true}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+	path := flag.String("path", ".", "the folder containing the storage.bdb file")
+	timeout := flag.Duration("timeout", time.Second, "how long to wait for the lock on the database file")
+	codec := flag.String("codec", "json", "the codec used for the new values: json, or binary")
+	compression := flag.String("compression", "none", "the compression used for the new values: none, flate, or gzip")
+	dict := flag.String("dict", "", "the file containing the compression dictionary")
+	keyFile := flag.String("key-file", "", "the file containing the raw AES key used for encrypting the metadata")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	conf := boltdb.Config{
+		Path:    *path,
+		Timeout: *timeout,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	}
+	if err := configure(&conf, *codec, *compression, *dict, *keyFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
+	if err := run(conf, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.Newf("invalid arguments, run with -h for usage")
+
+// configure sets the encoding and encryption options of conf, which have to match the ones the database was written with.
+func configure(conf *boltdb.Config, codec, compression, dict, keyFile string) error {
+	switch codec {
+	case "json":
+		conf.Codec = boltdb.JSONCodec
+	case "binary":
+		conf.Codec = boltdb.BinaryCodec
+	default:
+		return errors.Newf("invalid codec %q", codec)
+	}
+	switch compression {
+	case "none":
+		conf.Compression = boltdb.CompressNone
+	case "flate":
+		conf.Compression = boltdb.CompressFlate
+	case "gzip":
+		conf.Compression = boltdb.CompressGzip
+	default:
+		return errors.Newf("invalid compression %q", compression)
+	}
+	if dict != "" {
+		data, err := os.ReadFile(dict)
+		if err != nil {
+			return errors.Annotatef(err, "unable to read the compression dictionary")
+		}
+		conf.CompressionDictionary = data
+	}
+	if keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return errors.Annotatef(err, "unable to read the encryption key")
+		}
+		conf.EncryptionKey = key
+	} else if env := os.Getenv("BOLTAP_ENCRYPTION_KEY"); env != "" {
+		key, err := hex.DecodeString(env)
+		if err != nil {
+			return errors.Annotatef(err, "invalid BOLTAP_ENCRYPTION_KEY")
+		}
+		conf.EncryptionKey = key
+	}
+	return nil
+}
+
+func needArgs(args []string, n int) error {
+	if len(args) < n {
+		return errUsage
+	}
+	return nil
+}
+
+func run(conf boltdb.Config, cmd string, args []string) error {
+	switch cmd {
+	case "bootstrap":
+		return boltdb.Bootstrap(conf)
+	case "clean":
+		return boltdb.Clean(conf)
+	case "compact":
+		dst := ""
+		if len(args) > 0 {
+			dst = args[0]
+		}
+		report, err := boltdb.Compact(conf, dst)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d bytes, from %d bytes\n", report.Path, report.After, report.Before)
+		return nil
+	case "fsck":
+		return fsck(conf, args)
+	}
+
+	conf.ReadOnly = readOnly[cmd] || (cmd == "clients" && len(args) > 0 && args[0] == "list")
+	r, err := boltdb.New(conf)
+	if err != nil {
+		return err
+	}
+	if err = r.Open(); err != nil {
+		return err
+	}
+	defer r.Close()
+
+	switch cmd {
+	case "ls":
+		iri := vocab.IRI("")
+		if len(args) > 0 {
+			iri = vocab.IRI(args[0])
+		}
+		children, err := r.Children(iri)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			fmt.Println(child)
+		}
+	case "get":
+		if err = needArgs(args, 1); err != nil {
+			return err
+		}
+		it, err := r.Load(vocab.IRI(args[0]))
+		if err != nil {
+			return err
+		}
+		data, err := vocab.MarshalJSON(it)
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	case "meta":
+		if err = needArgs(args, 1); err != nil {
+			return err
+		}
+		m := new(boltdb.Metadata)
+		if err = r.LoadMetadata(vocab.IRI(args[0]), m); err != nil {
+			return err
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	case "put":
+		if err = needArgs(args, 1); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		it, err := vocab.UnmarshalJSON(data)
+		if err != nil {
+			return err
+		}
+		if it.GetLink() != vocab.IRI(args[0]) {
+			return errors.Newf("the object's id %s doesn't match %s", it.GetLink(), args[0])
+		}
+		_, err = r.Save(it)
+		return err
+	case "add-to":
+		if err = needArgs(args, 2); err != nil {
+			return err
+		}
+		return r.AddTo(vocab.IRI(args[0]), vocab.IRI(args[1]))
+	case "rm":
+		if err = needArgs(args, 1); err != nil {
+			return err
+		}
+		// NOTE: we delete by IRI, as deleting a loaded collection would remove all its members too
+		return r.Delete(vocab.IRI(args[0]))
+	case "backup":
+		if err = needArgs(args, 1); err != nil {
+			return err
+		}
+		n, err := r.BackupToFile(args[0], true)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d bytes\n", args[0], n)
+	case "clients":
+		return clients(r, args)
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func printJSON(data []byte) error {
+	buf := bytes.Buffer{}
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(os.Stdout)
+	return err
+}
+
+func fsck(conf boltdb.Config, args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "fix the inconsistencies which can be fixed safely")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	check := boltdb.Check
+	if *repair {
+		check = boltdb.Repair
+	}
+	report, err := check(conf)
+	if err != nil {
+		return err
+	}
+	for _, p := range report.Problems {
+		status := ""
+		if p.Repaired {
+			status = " (repaired)"
+		}
+		fmt.Printf("%s\t%s\t%s%s\n", p.Kind, p.Path, p.Detail, status)
+	}
+	if len(report.Problems) == 0 {
+		fmt.Println("no problems found")
+	}
+	return nil
+}
+
+type clientStore interface {
+	ListClients() ([]osin.Client, error)
+	SaveClient(osin.Client) error
+	RemoveClient(string) error
+}
+
+func clients(r clientStore, args []string) error {
+	if err := needArgs(args, 1); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		cl, err := r.ListClients()
+		if err != nil {
+			return err
+		}
+		for _, c := range cl {
+			fmt.Printf("%s\t%s\n", c.GetId(), c.GetRedirectUri())
+		}
+		return nil
+	case "add":
+		if err := needArgs(args, 4); err != nil {
+			return err
+		}
+		return r.SaveClient(&osin.DefaultClient{Id: args[1], Secret: args[2], RedirectUri: args[3]})
+	case "remove":
+		if err := needArgs(args, 2); err != nil {
+			return err
+		}
+		return r.RemoveClient(args[1])
+	}
+	return errUsage
+}
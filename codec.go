@@ -0,0 +1,202 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+// Codec encodes and decodes the values stored in the database: the activitypub items,
+// their metadata, and the OAuth2 data.
+type Codec interface {
+	// Tag is the one byte format tag prefixed to every value encoded with the codec.
+	// It must not be a printable ASCII character, nor a tab or newline, as those start the untagged JSON values
+	// of the databases created before the tags existed. The 0x01 and 0x02 tags are used by JSONCodec and
+	// BinaryCodec, 0x10 to 0x12 by the compressed values, and 0x20 by the encrypted ones.
+	// New returns an error for a Codec using one of these reserved tags.
+	Tag() byte
+	EncodeItem(vocab.Item) ([]byte, error)
+	DecodeItem([]byte) (vocab.Item, error)
+	Encode(any) ([]byte, error)
+	Decode([]byte, any) error
+}
+
+const (
+	tagJSON   byte = 0x01
+	tagBinary byte = 0x02
+)
+
+var (
+	// JSONCodec stores the values as JSON, it's the default codec.
+	JSONCodec Codec = jsonCodec{}
+	// BinaryCodec stores the values using encoding/gob, which is more compact and faster to decode than JSON.
+	BinaryCodec Codec = gobCodec{}
+)
+
+// NOTE: the values are decoded using the codec matching their format tag, not the configured one,
+// so a database can contain values written with different codecs, as during a rolling migration.
+var builtinCodecs = map[byte]Codec{
+	tagJSON:   JSONCodec,
+	tagBinary: BinaryCodec,
+}
+
+var ErrorReservedCodecTag = func(tag byte) error {
+	return errors.Newf("codec tag %#x is reserved", tag)
+}
+
+// checkCodecTag returns an error if the tag of the custom codec c can be mistaken for another value format.
+func checkCodecTag(c Codec) error {
+	if c == nil || c == JSONCodec || c == BinaryCodec {
+		return nil
+	}
+	switch tag := c.Tag(); {
+	case tag >= ' ' && tag <= '~', tag == '\t', tag == '\n', tag == '\r':
+		return ErrorReservedCodecTag(tag)
+	case tag == tagJSON, tag == tagBinary, tag == tagFlate, tag == tagFlateDict, tag == tagGzip, tag == tagAESGCM:
+		return ErrorReservedCodecTag(tag)
+	}
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Tag() byte {
+	return tagJSON
+}
+
+func (jsonCodec) EncodeItem(it vocab.Item) ([]byte, error) {
+	return encodeItemFn(it)
+}
+
+func (jsonCodec) DecodeItem(data []byte) (vocab.Item, error) {
+	return decodeItemFn(data)
+}
+
+func (jsonCodec) Encode(v any) ([]byte, error) {
+	return encodeFn(v)
+}
+
+func (jsonCodec) Decode(data []byte, v any) error {
+	return decodeFn(data, v)
+}
+
+func init() {
+	for _, typ := range []any{
+		vocab.IRI(""), vocab.IRIs{}, vocab.ItemCollection{},
+		vocab.ActivityVocabularyType(""), vocab.ActivityVocabularyTypes{},
+		&vocab.Object{}, &vocab.Link{}, &vocab.Actor{}, &vocab.Activity{}, &vocab.IntransitiveActivity{},
+		&vocab.Question{}, &vocab.Tombstone{}, &vocab.Place{}, &vocab.Profile{}, &vocab.Relationship{},
+		&vocab.Collection{}, &vocab.OrderedCollection{}, &vocab.CollectionPage{}, &vocab.OrderedCollectionPage{},
+	} {
+		gob.Register(typ)
+	}
+}
+
+// gobItem wraps the items, so gob can encode them through their vocab.Item interface.
+type gobItem struct {
+	It vocab.Item
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Tag() byte {
+	return tagBinary
+}
+
+func (gobCodec) EncodeItem(it vocab.Item) ([]byte, error) {
+	return gobCodec{}.Encode(gobItem{It: it})
+}
+
+func (gobCodec) DecodeItem(data []byte) (vocab.Item, error) {
+	w := gobItem{}
+	if err := (gobCodec{}).Decode(data, &w); err != nil {
+		return nil, err
+	}
+	return w.It, nil
+}
+
+func (gobCodec) Encode(v any) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Decode(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (r *repo) valueCodec() Codec {
+	if r.codec == nil {
+		return JSONCodec
+	}
+	return r.codec
+}
+
+// codecFor returns the codec the raw value has been encoded with, and the encoded payload without the format tag.
+// Compressed values are decompressed first, the encrypted ones need to be unsealed before.
+// Values without a tag have been stored as JSON.
+func (r *repo) codecFor(raw []byte) (Codec, []byte, error) {
+	raw, err := r.decompress(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) == 0 {
+		return JSONCodec, raw, nil
+	}
+	tag := raw[0]
+	if (tag >= ' ' && tag <= '~') || tag == '\t' || tag == '\n' || tag == '\r' {
+		return JSONCodec, raw, nil
+	}
+	if c := r.valueCodec(); c.Tag() == tag {
+		return c, raw[1:], nil
+	}
+	if c, ok := builtinCodecs[tag]; ok {
+		return c, raw[1:], nil
+	}
+	return nil, nil, errors.Errorf("unknown value format %#x", tag)
+}
+
+func (r *repo) encodeItem(it vocab.Item) ([]byte, error) {
+	c := r.valueCodec()
+	data, err := c.EncodeItem(it)
+	if err != nil {
+		return nil, err
+	}
+	return r.compress(append([]byte{c.Tag()}, data...))
+}
+
+func (r *repo) decodeItem(raw []byte) (vocab.Item, error) {
+	c, data, err := r.codecFor(raw)
+	if err != nil {
+		return nil, err
+	}
+	return c.DecodeItem(data)
+}
+
+func (r *repo) encode(v any) ([]byte, error) {
+	c := r.valueCodec()
+	data, err := c.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{c.Tag()}, data...), nil
+}
+
+func (r *repo) decode(raw []byte, v any) error {
+	c, data, err := r.codecFor(raw)
+	if err != nil {
+		return err
+	}
+	return c.Decode(data, v)
+}
+
+// matchesRaw runs the matcherFn built by filters.RawMatcher, which works on JSON, on the data payload returned by
+// codecFor. Values stored with other codecs can't be matched before decoding, so they always match.
+func matchesRaw(matcherFn func([]byte) bool, c Codec, data []byte) bool {
+	if matcherFn == nil || c.Tag() != tagJSON {
+		return true
+	}
+	return matcherFn(data)
+}
@@ -0,0 +1,250 @@
+package boltdb
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_repo_encodeItem(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   Codec
+		wantTag byte
+	}{
+		{
+			name:    "default",
+			wantTag: tagJSON,
+		},
+		{
+			name:    "json",
+			codec:   JSONCodec,
+			wantTag: tagJSON,
+		},
+		{
+			name:    "binary",
+			codec:   BinaryCodec,
+			wantTag: tagBinary,
+		},
+	}
+	for _, tt := range tests {
+		for _, it := range mockItems {
+			t.Run(tt.name, func(t *testing.T) {
+				r := &repo{codec: tt.codec}
+				raw, err := r.encodeItem(it)
+				if err != nil {
+					t.Fatalf("encodeItem() error = %s", err)
+				}
+				if raw[0] != tt.wantTag {
+					t.Errorf("encodeItem() format tag = %#x, want %#x", raw[0], tt.wantTag)
+				}
+				got, err := r.decodeItem(raw)
+				if err != nil {
+					t.Fatalf("decodeItem() error = %s", err)
+				}
+				if !vocab.ItemsEqual(got, it) {
+					t.Errorf("decodeItem() = %s", cmp.Diff(it, got))
+				}
+			})
+		}
+	}
+}
+
+func Test_repo_codecFor(t *testing.T) {
+	legacy, _ := encodeItemFn(&vocab.Object{ID: "https://example.com/1", Type: vocab.NoteType})
+	tests := []struct {
+		name    string
+		raw     []byte
+		want    Codec
+		wantErr error
+	}{
+		{
+			name: "untagged JSON",
+			raw:  legacy,
+			want: JSONCodec,
+		},
+		{
+			name: "tagged JSON",
+			raw:  append([]byte{tagJSON}, legacy...),
+			want: JSONCodec,
+		},
+		{
+			name: "binary",
+			raw:  []byte{tagBinary, 0},
+			want: BinaryCodec,
+		},
+		{
+			name:    "unknown tag",
+			raw:     []byte{0x7f, 0},
+			wantErr: errors.Errorf("unknown value format %#x", 0x7f),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := (&repo{}).codecFor(tt.raw)
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("codecFor() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+			if got != tt.want {
+				t.Errorf("codecFor() = %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_repo_MixedCodecs(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems, withMetadataJDoe)
+	t.Cleanup(r.Close)
+
+	// NOTE: switching the codec keeps loading the values stored with the previous one
+	r.codec = BinaryCodec
+	note := &vocab.Object{ID: "https://example.com/objects/binary", Type: vocab.NoteType}
+	if _, err := r.Save(note); err != nil {
+		t.Fatalf("Save() with binary codec error = %s", err)
+	}
+	for _, it := range append(mockItems, note) {
+		if vocab.IsIRI(it) {
+			continue
+		}
+		got, err := r.Load(it.GetLink())
+		if err != nil {
+			t.Errorf("Load() of %s error = %s", it.GetLink(), err)
+			continue
+		}
+		if got.GetLink() != it.GetLink() {
+			t.Errorf("Load() of %s returned %s", it.GetLink(), got.GetLink())
+		}
+	}
+	m := new(Metadata)
+	if err := r.LoadMetadata("https://example.com/~jdoe", m); err != nil {
+		t.Errorf("LoadMetadata() of JSON metadata error = %s", err)
+	}
+	if err := r.SaveMetadata("https://example.com/~jdoe", m); err != nil {
+		t.Errorf("SaveMetadata() with binary codec error = %s", err)
+	}
+	if err := r.LoadMetadata("https://example.com/~jdoe", m); err != nil {
+		t.Errorf("LoadMetadata() of binary metadata error = %s", err)
+	}
+}
+
+func Test_repo_BinaryCodec_osin(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap)
+	t.Cleanup(r.Close)
+	r.codec = BinaryCodec
+
+	if err := r.SaveClient(defaultClient); err != nil {
+		t.Fatalf("SaveClient() error = %s", err)
+	}
+	client, err := r.GetClient(defaultClient.Id)
+	if err != nil {
+		t.Fatalf("GetClient() error = %s", err)
+	}
+	if !cmp.Equal(client, defaultClient) {
+		t.Errorf("GetClient() diff %s", cmp.Diff(defaultClient, client))
+	}
+
+	wantAuth := mockAuth("test-code", defaultClient)
+	if err = r.SaveAuthorize(wantAuth); err != nil {
+		t.Fatalf("SaveAuthorize() error = %s", err)
+	}
+	gotAuth, err := r.LoadAuthorize(wantAuth.Code)
+	if err != nil {
+		t.Fatalf("LoadAuthorize() error = %s", err)
+	}
+	if !cmp.Equal(gotAuth, wantAuth) {
+		t.Errorf("LoadAuthorize() diff %s", cmp.Diff(wantAuth, gotAuth))
+	}
+
+	wantAcc := mockAccess("access-666", defaultClient)
+	if err = r.SaveAccess(wantAcc); err != nil {
+		t.Fatalf("SaveAccess() error = %s", err)
+	}
+	gotAcc, err := r.LoadAccess(wantAcc.AccessToken)
+	if err != nil {
+		t.Fatalf("LoadAccess() error = %s", err)
+	}
+	if gotAcc.AccessToken != wantAcc.AccessToken || gotAcc.Client.GetId() != defaultClient.Id {
+		t.Errorf("LoadAccess() = %#v, want %#v", gotAcc, wantAcc)
+	}
+	if gotAcc.AuthorizeData == nil || gotAcc.AuthorizeData.Code != wantAuth.Code {
+		t.Errorf("LoadAccess() authorize data = %#v, want %#v", gotAcc.AuthorizeData, wantAuth)
+	}
+
+	gotRef, err := r.LoadRefresh(wantAcc.RefreshToken)
+	if err != nil {
+		t.Fatalf("LoadRefresh() error = %s", err)
+	}
+	if gotRef.AccessToken != wantAcc.AccessToken {
+		t.Errorf("LoadRefresh() access token = %s, want %s", gotRef.AccessToken, wantAcc.AccessToken)
+	}
+}
+
+type taggedCodec struct {
+	jsonCodec
+	tag byte
+}
+
+func (c taggedCodec) Tag() byte {
+	return c.tag
+}
+
+func Test_checkCodecTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       Codec
+		wantErr error
+	}{
+		{
+			name: "default codec",
+		},
+		{
+			name: "json codec",
+			c:    JSONCodec,
+		},
+		{
+			name: "binary codec",
+			c:    BinaryCodec,
+		},
+		{
+			name: "custom tag",
+			c:    taggedCodec{tag: 0x03},
+		},
+		{
+			name:    "printable tag",
+			c:       taggedCodec{tag: '{'},
+			wantErr: ErrorReservedCodecTag('{'),
+		},
+		{
+			name:    "newline tag",
+			c:       taggedCodec{tag: '\n'},
+			wantErr: ErrorReservedCodecTag('\n'),
+		},
+		{
+			name:    "binary codec tag",
+			c:       taggedCodec{tag: tagBinary},
+			wantErr: ErrorReservedCodecTag(tagBinary),
+		},
+		{
+			name:    "compression tag",
+			c:       taggedCodec{tag: tagFlateDict},
+			wantErr: ErrorReservedCodecTag(tagFlateDict),
+		},
+		{
+			name:    "encryption tag",
+			c:       taggedCodec{tag: tagAESGCM},
+			wantErr: ErrorReservedCodecTag(tagAESGCM),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkCodecTag(tt.c); !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("checkCodecTag() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+		})
+	}
+	if _, err := New(Config{Path: t.TempDir(), Codec: taggedCodec{tag: tagGzip}}); err == nil {
+		t.Errorf("New() with a reserved codec tag returned no error")
+	}
+}
@@ -0,0 +1,182 @@
+package boltdb
+
+import (
+	"encoding/binary"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// NOTE: collection members are stored in two sub-buckets of the collection bucket:
+// __items maps an insertion ordered sequence to the member IRI, and __members maps the IRI back
+// to its sequence, so we can append, remove and seek to a member without decoding the whole collection.
+const (
+	itemsBucket   = "__items"
+	membersBucket = "__members"
+)
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func isReservedKey(k []byte) bool {
+	switch string(k) {
+	case objectKey, metaDataKey, itemsBucket, membersBucket, historyBucket:
+		return true
+	}
+	return false
+}
+
+// memberKey returns the sequence key under which iri is stored in the collection bucket b, or nil if it's not a member.
+func memberKey(b *bolt.Bucket, iri vocab.IRI) []byte {
+	if b == nil {
+		return nil
+	}
+	mb := b.Bucket([]byte(membersBucket))
+	if mb == nil {
+		return nil
+	}
+	return mb.Get([]byte(iri))
+}
+
+// collectionMembers returns the IRIs of all the members stored as per-item keys in the collection bucket b.
+func collectionMembers(b *bolt.Bucket) vocab.ItemCollection {
+	iris := make(vocab.ItemCollection, 0)
+	if b == nil {
+		return iris
+	}
+	ib := b.Bucket([]byte(itemsBucket))
+	if ib == nil {
+		return iris
+	}
+	_ = ib.ForEach(func(_, v []byte) error {
+		iris = append(iris, vocab.IRI(v))
+		return nil
+	})
+	return iris
+}
+
+// appendToCollectionBucket stores iri as the last member of the collection bucket b.
+// It returns false, without changing the collection, if the iri is already a member.
+func appendToCollectionBucket(b *bolt.Bucket, iri vocab.IRI) (bool, error) {
+	if !b.Writable() {
+		return false, errors.Errorf("Non writeable bucket")
+	}
+	if memberKey(b, iri) != nil {
+		return false, nil
+	}
+	ib, err := b.CreateBucketIfNotExists([]byte(itemsBucket))
+	if err != nil {
+		return false, errors.Annotatef(err, "could not create collection items bucket")
+	}
+	mb, err := b.CreateBucketIfNotExists([]byte(membersBucket))
+	if err != nil {
+		return false, errors.Annotatef(err, "could not create collection members bucket")
+	}
+	seq, err := ib.NextSequence()
+	if err != nil {
+		return false, errors.Annotatef(err, "could not generate collection sequence")
+	}
+	key := itob(seq)
+	if err = ib.Put(key, []byte(iri)); err != nil {
+		return false, errors.Annotatef(err, "could not store collection item %s", iri)
+	}
+	if err = mb.Put([]byte(iri), key); err != nil {
+		return false, errors.Annotatef(err, "could not store collection member %s", iri)
+	}
+	return true, nil
+}
+
+// removeFromCollectionBucket removes iri from the members of the collection bucket b.
+// It returns false if the iri was not a member.
+func removeFromCollectionBucket(b *bolt.Bucket, iri vocab.IRI) (bool, error) {
+	key := memberKey(b, iri)
+	if key == nil {
+		return false, nil
+	}
+	if ib := b.Bucket([]byte(itemsBucket)); ib != nil {
+		if err := ib.Delete(key); err != nil {
+			return false, errors.Annotatef(err, "could not remove collection item %s", iri)
+		}
+	}
+	if err := b.Bucket([]byte(membersBucket)).Delete([]byte(iri)); err != nil {
+		return false, errors.Annotatef(err, "could not remove collection member %s", iri)
+	}
+	return true, nil
+}
+
+func onCollectionHeader(col vocab.Item, fn func(items *vocab.ItemCollection, total *uint)) error {
+	if orderedCollectionTypes.Match(col.GetType()) {
+		return vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
+			fn(&c.OrderedItems, &c.TotalItems)
+			return nil
+		})
+	}
+	return vocab.OnCollection(col, func(c *vocab.Collection) error {
+		fn(&c.Items, &c.TotalItems)
+		return nil
+	})
+}
+
+// saveCollectionHeader stores the items kept inline in the col collection as per-item keys of the collection
+// bucket b, and saves only the collection header in __raw. The items are logged as added to the collection.
+func (r *repo) saveCollectionHeader(root, b *bolt.Bucket, col vocab.Item) error {
+	var inline vocab.ItemCollection
+	_ = onCollectionHeader(col, func(items *vocab.ItemCollection, _ *uint) {
+		inline, *items = *items, nil
+	})
+	// NOTE: the items are put back, as col can be the caller's value
+	defer func() {
+		_ = onCollectionHeader(col, func(items *vocab.ItemCollection, _ *uint) {
+			*items = inline
+		})
+	}()
+	for _, it := range inline {
+		if vocab.IsNil(it) {
+			continue
+		}
+		added, err := appendToCollectionBucket(b, it.GetLink())
+		if err != nil {
+			return err
+		}
+		if err = addMembership(root, col.GetLink(), it.GetLink()); err != nil {
+			return err
+		}
+		if !added {
+			continue
+		}
+		if err = r.logChange(root, Change{Op: OpAddTo, IRI: it.GetLink(), Collection: col.GetLink()}); err != nil {
+			return err
+		}
+	}
+	return r.saveRawItem(col, b)
+}
+
+// decrementTotal subtracts n from the TotalItems of the col collection, without going below zero.
+func decrementTotal(col vocab.Item, n uint) error {
+	return onCollectionHeader(col, func(_ *vocab.ItemCollection, total *uint) {
+		if *total <= n {
+			*total = 0
+		} else {
+			*total -= n
+		}
+	})
+}
+
+// decrementCollectionTotal subtracts n from the TotalItems of the collection stored in bucket b.
+func (r *repo) decrementCollectionTotal(b *bolt.Bucket, n uint) error {
+	col, err := r.loadRawItemFromBucket(b)
+	if err != nil {
+		return err
+	}
+	if !vocab.IsCollection(col) {
+		return nil
+	}
+	if err = decrementTotal(col, n); err != nil {
+		return err
+	}
+	return r.saveRawItem(col, b)
+}
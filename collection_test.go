@@ -0,0 +1,163 @@
+package boltdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestDB(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), dbFile), 0600, nil)
+	if err != nil {
+		t.Fatalf("unable to open boltdb: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func withCollectionBucket(t *testing.T, db *bolt.DB, fn func(b *bolt.Bucket) error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("collection"))
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+	if err != nil {
+		t.Fatalf("collection bucket update failed: %s", err)
+	}
+}
+
+func Test_appendToCollectionBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		append vocab.IRIs
+		want   vocab.ItemCollection
+	}{
+		{
+			name: "empty",
+			want: vocab.ItemCollection{},
+		},
+		{
+			name:   "two items",
+			append: vocab.IRIs{"https://example.com/1", "https://example.com/2"},
+			want:   vocab.ItemCollection{vocab.IRI("https://example.com/1"), vocab.IRI("https://example.com/2")},
+		},
+		{
+			name:   "re-adding an existing member is a no-op",
+			append: vocab.IRIs{"https://example.com/1", "https://example.com/2", "https://example.com/1"},
+			want:   vocab.ItemCollection{vocab.IRI("https://example.com/1"), vocab.IRI("https://example.com/2")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			withCollectionBucket(t, db, func(b *bolt.Bucket) error {
+				added := 0
+				for _, iri := range tt.append {
+					ok, err := appendToCollectionBucket(b, iri)
+					if err != nil {
+						return err
+					}
+					if ok {
+						added++
+					}
+				}
+				if added != len(tt.want) {
+					t.Errorf("appendToCollectionBucket() added %d items, want %d", added, len(tt.want))
+				}
+				got := collectionMembers(b)
+				if !cmp.Equal(got, tt.want, EquateItemCollections) {
+					t.Errorf("collectionMembers() = %s", cmp.Diff(tt.want, got, EquateItemCollections))
+				}
+				for _, iri := range tt.append {
+					if memberKey(b, iri) == nil {
+						t.Errorf("memberKey() for %s is nil", iri)
+					}
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func Test_removeFromCollectionBucket(t *testing.T) {
+	db := openTestDB(t)
+	withCollectionBucket(t, db, func(b *bolt.Bucket) error {
+		_, _ = appendToCollectionBucket(b, "https://example.com/1")
+		_, _ = appendToCollectionBucket(b, "https://example.com/2")
+
+		removed, err := removeFromCollectionBucket(b, "https://example.com/1")
+		if err != nil || !removed {
+			t.Errorf("removeFromCollectionBucket() = %t, %v, expected to remove existing member", removed, err)
+		}
+		removed, err = removeFromCollectionBucket(b, "https://example.com/missing")
+		if err != nil || removed {
+			t.Errorf("removeFromCollectionBucket() = %t, %v, expected no-op for missing member", removed, err)
+		}
+		want := vocab.ItemCollection{vocab.IRI("https://example.com/2")}
+		if got := collectionMembers(b); !cmp.Equal(got, want, EquateItemCollections) {
+			t.Errorf("collectionMembers() after removal = %s", cmp.Diff(want, got, EquateItemCollections))
+		}
+		if memberKey(b, "https://example.com/1") != nil {
+			t.Errorf("memberKey() for removed item should be nil")
+		}
+		return nil
+	})
+}
+
+func Test_repo_saveCollectionHeader(t *testing.T) {
+	db := openTestDB(t)
+	inline := vocab.ItemCollection{vocab.IRI("https://example.com/1"), vocab.IRI("https://example.com/2")}
+	r := &repo{root: []byte(rootBucket)}
+	withCollectionBucket(t, db, func(b *bolt.Bucket) error {
+		col := &vocab.OrderedCollection{
+			ID:           "https://example.com/outbox",
+			Type:         vocab.OrderedCollectionType,
+			OrderedItems: inline,
+			TotalItems:   2,
+		}
+		root, err := b.Tx().CreateBucketIfNotExists([]byte(rootBucket))
+		if err != nil {
+			return err
+		}
+		if err = r.saveCollectionHeader(root, b, col); err != nil {
+			return err
+		}
+		for _, it := range inline {
+			if got := containedIn(root, it.GetLink()); !cmp.Equal(got, []vocab.IRI{col.ID}) {
+				t.Errorf("containedIn() after save = %s", cmp.Diff([]vocab.IRI{col.ID}, got))
+			}
+		}
+		if !cmp.Equal(col.OrderedItems, inline, EquateItemCollections) {
+			t.Errorf("saveCollectionHeader() changed the saved collection items %s", cmp.Diff(inline, col.OrderedItems, EquateItemCollections))
+		}
+		return nil
+	})
+	_ = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("collection"))
+		if got := collectionMembers(b); !cmp.Equal(got, inline, EquateItemCollections) {
+			t.Errorf("collectionMembers() after save = %s", cmp.Diff(inline, got, EquateItemCollections))
+		}
+		col, err := r.loadRawItemFromBucket(b)
+		if err != nil {
+			t.Errorf("unable to load saved collection header: %s", err)
+			return nil
+		}
+		_ = vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
+			if len(c.OrderedItems) > 0 {
+				t.Errorf("saved collection header still has %d inline items", len(c.OrderedItems))
+			}
+			if c.TotalItems != 2 {
+				t.Errorf("saved collection header TotalItems = %d, want 2", c.TotalItems)
+			}
+			return nil
+		})
+		return nil
+	})
+}
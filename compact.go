@@ -0,0 +1,97 @@
+package boltdb
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// compactTxMaxSize is the size, in bytes, of the data copied by Compact in a single transaction.
+	compactTxMaxSize = 64 << 20
+	// compactLockTimeout is how long Compact waits for the lock on the database file, when the Config has no Timeout.
+	compactLockTimeout = time.Second
+)
+
+// CompactReport holds the sizes of the database before and after the compaction.
+type CompactReport struct {
+	Path   string
+	Before int64
+	After  int64
+}
+
+// Compact copies all the buckets of the database described by conf into a fresh file at dst, which must not exist,
+// leaving behind the free pages of the source.
+// If dst is empty, the compacted copy replaces the source database.
+// It fails if the database is opened read-write by another process, and, when replacing it, if it's opened at all.
+func Compact(conf Config, dst string) (CompactReport, error) {
+	report := CompactReport{}
+	r, err := New(conf)
+	if err != nil {
+		return report, err
+	}
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		return report, err
+	}
+	report.Before = fi.Size()
+
+	swap := dst == ""
+	opts := r.options
+	opts.ReadOnly = !swap
+	if opts.Timeout == 0 {
+		opts.Timeout = compactLockTimeout
+	}
+	src, err := bolt.Open(r.path, r.fileMode, &opts)
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return report, errors.Annotatef(err, "database %s is in use", r.path)
+		}
+		return report, err
+	}
+	defer src.Close()
+
+	if swap {
+		f, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".compact-*")
+		if err != nil {
+			return report, errors.Annotatef(err, "unable to create temporary file")
+		}
+		_ = f.Close()
+		dst = f.Name()
+		defer os.Remove(dst)
+	} else if _, err = os.Stat(dst); err == nil {
+		return report, errors.Newf("destination %s already exists", dst)
+	}
+
+	db, err := bolt.Open(dst, r.fileMode, &bolt.Options{Timeout: opts.Timeout, FreelistType: opts.FreelistType})
+	if err != nil {
+		return report, err
+	}
+	if err = bolt.Compact(db, src, compactTxMaxSize); err != nil {
+		_ = db.Close()
+		return report, errors.Annotatef(err, "unable to compact %s", r.path)
+	}
+	if err = db.Close(); err != nil {
+		return report, err
+	}
+	if fi, err = os.Stat(dst); err != nil {
+		return report, err
+	}
+	report.After = fi.Size()
+	report.Path = dst
+
+	if swap {
+		if err = os.Chmod(dst, r.fileMode); err != nil {
+			return report, errors.Annotatef(err, "unable to change mode of %s", dst)
+		}
+		// NOTE: we still hold the exclusive lock of the source while replacing it
+		if err = os.Rename(dst, r.path); err != nil {
+			return report, errors.Annotatef(err, "unable to replace %s", r.path)
+		}
+		report.Path = r.path
+	}
+	return report, nil
+}
@@ -0,0 +1,88 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withDeletedItems(count int) initFn {
+	return func(t *testing.T, r *repo) *repo {
+		for i := 0; i < count; i++ {
+			ob := &vocab.Object{ID: vocab.IRI(fmt.Sprintf("https://example.com/deleted/%d", i)), Type: vocab.NoteType}
+			if _, err := save(context.Background(), r, ob); err != nil {
+				t.Errorf("unable to save item %s: %s", ob.ID, err)
+			}
+		}
+		for i := 0; i < count; i++ {
+			ob := &vocab.Object{ID: vocab.IRI(fmt.Sprintf("https://example.com/deleted/%d", i)), Type: vocab.NoteType}
+			if err := r.Delete(ob); err != nil {
+				t.Errorf("unable to delete item %s: %s", ob.ID, err)
+			}
+		}
+		return r
+	}
+}
+
+func Test_Compact(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  string
+	}{
+		{
+			name: "to new file",
+			dst:  filepath.Join(t.TempDir(), "compacted.bdb"),
+		},
+		{
+			name: "in place",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := Config{Path: t.TempDir()}
+			w := mockRepo(t, fields{path: conf.Path}, withOpenRoot, withBootstrap, withMockItems, withDeletedItems(500))
+			w.Close()
+
+			report, err := Compact(conf, tt.dst)
+			if err != nil {
+				t.Fatalf("Compact() error = %s", err)
+			}
+			if report.After > report.Before {
+				t.Errorf("Compact() size grew from %d to %d", report.Before, report.After)
+			}
+			want := tt.dst
+			if want == "" {
+				want, _ = Path(conf)
+			}
+			if report.Path != want {
+				t.Errorf("Compact() path = %s, want %s", report.Path, want)
+			}
+
+			r, _ := New(conf)
+			r.path = report.Path
+			if err = r.Open(); err != nil {
+				t.Fatalf("Open() of compacted db error = %s", err)
+			}
+			t.Cleanup(r.Close)
+			if _, err = r.Load("https://example.com/1"); err != nil {
+				t.Errorf("Load() from compacted db error = %s", err)
+			}
+		})
+	}
+}
+
+func Test_Compact_InUse(t *testing.T) {
+	conf := Config{Path: t.TempDir(), Timeout: 50 * time.Millisecond}
+	r := mockRepo(t, fields{path: conf.Path}, withOpenRoot, withBootstrap, withMockItems)
+	t.Cleanup(r.Close)
+
+	if _, err := Compact(conf, filepath.Join(t.TempDir(), "compacted.bdb")); !errors.Is(err, bolt.ErrTimeout) {
+		t.Errorf("Compact() of db in use error = %v, want %v", err, bolt.ErrTimeout)
+	}
+}
@@ -0,0 +1,116 @@
+package boltdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/go-ap/errors"
+)
+
+// Compression is the algorithm used for compressing the objects and the metadata stored in the database.
+type Compression uint8
+
+const (
+	// CompressNone stores the values uncompressed, it's the default.
+	CompressNone Compression = iota
+	// CompressFlate compresses the values using compress/flate, with the CompressionDictionary if one is set.
+	CompressFlate
+	// CompressGzip compresses the values using compress/gzip.
+	CompressGzip
+)
+
+// NOTE: the compressed values are prefixed with a one byte header, which doesn't overlap with the codec
+// format tags, so compressed and uncompressed values can coexist in the same database.
+// The values compressed with a dictionary also store the CRC32 checksum of the dictionary after the header,
+// which allows us to fail loudly when reading them back with a different one.
+const (
+	tagFlate     byte = 0x10
+	tagFlateDict byte = 0x11
+	tagGzip      byte = 0x12
+)
+
+func dictionaryChecksum(dict []byte) []byte {
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(dict))
+	return sum
+}
+
+// compress returns the raw value compressed with the repository's compression algorithm.
+// If compressing doesn't make the value smaller, it's returned unchanged.
+func (r *repo) compress(raw []byte) ([]byte, error) {
+	if r.compression == CompressNone || len(raw) == 0 {
+		return raw, nil
+	}
+
+	buf := bytes.Buffer{}
+	var w io.WriteCloser
+	var err error
+	switch r.compression {
+	case CompressFlate:
+		if len(r.dictionary) > 0 {
+			buf.WriteByte(tagFlateDict)
+			buf.Write(dictionaryChecksum(r.dictionary))
+			w, err = flate.NewWriterDict(&buf, flate.DefaultCompression, r.dictionary)
+		} else {
+			buf.WriteByte(tagFlate)
+			w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+		}
+	case CompressGzip:
+		buf.WriteByte(tagGzip)
+		w = gzip.NewWriter(&buf)
+	default:
+		return nil, errors.Newf("unknown compression %d", r.compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(raw); err != nil {
+		return nil, errors.Annotatef(err, "could not compress value")
+	}
+	if err = w.Close(); err != nil {
+		return nil, errors.Annotatef(err, "could not compress value")
+	}
+	if buf.Len() >= len(raw) {
+		return raw, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns the uncompressed raw value, values which have not been compressed are returned unchanged.
+func (r *repo) decompress(raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+
+	var rd io.ReadCloser
+	switch raw[0] {
+	case tagFlate:
+		rd = flate.NewReader(bytes.NewReader(raw[1:]))
+	case tagFlateDict:
+		if len(raw) < 5 {
+			return nil, errors.Newf("invalid compressed value")
+		}
+		if len(r.dictionary) == 0 || !bytes.Equal(raw[1:5], dictionaryChecksum(r.dictionary)) {
+			return nil, errors.Newf("value has been compressed with a different dictionary")
+		}
+		rd = flate.NewReaderDict(bytes.NewReader(raw[5:]), r.dictionary)
+	case tagGzip:
+		var err error
+		if rd, err = gzip.NewReader(bytes.NewReader(raw[1:])); err != nil {
+			return nil, errors.Annotatef(err, "could not decompress value")
+		}
+	default:
+		return raw, nil
+	}
+	defer rd.Close()
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not decompress value")
+	}
+	return data, nil
+}
@@ -0,0 +1,157 @@
+package boltdb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+var mockDictionary = []byte(`"@context":"https://www.w3.org/ns/activitystreams","type":"Note","id":"https://example.com/objects/`)
+
+func Test_repo_compress(t *testing.T) {
+	value, _ := encodeItemFn(&vocab.Object{
+		ID:   "https://example.com/objects/1",
+		Type: vocab.NoteType,
+		URL:  vocab.IRI("https://example.com/" + strings.Repeat("lorem-ipsum-dolor-sit-amet/", 20)),
+	})
+	tests := []struct {
+		name        string
+		compression Compression
+		dictionary  []byte
+		wantTag     byte
+	}{
+		{
+			name:        "none",
+			compression: CompressNone,
+			wantTag:     value[0],
+		},
+		{
+			name:        "flate",
+			compression: CompressFlate,
+			wantTag:     tagFlate,
+		},
+		{
+			name:        "flate with dictionary",
+			compression: CompressFlate,
+			dictionary:  mockDictionary,
+			wantTag:     tagFlateDict,
+		},
+		{
+			name:        "gzip",
+			compression: CompressGzip,
+			wantTag:     tagGzip,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &repo{compression: tt.compression, dictionary: tt.dictionary}
+			raw, err := r.compress(value)
+			if err != nil {
+				t.Fatalf("compress() error = %s", err)
+			}
+			if raw[0] != tt.wantTag {
+				t.Errorf("compress() header = %#x, want %#x", raw[0], tt.wantTag)
+			}
+			if tt.compression != CompressNone && len(raw) >= len(value) {
+				t.Errorf("compress() size = %d, expected less than %d", len(raw), len(value))
+			}
+			got, err := r.decompress(raw)
+			if err != nil {
+				t.Fatalf("decompress() error = %s", err)
+			}
+			if !bytes.Equal(got, value) {
+				t.Errorf("decompress() = %s", cmp.Diff(string(value), string(got)))
+			}
+		})
+	}
+}
+
+func Test_repo_decompress_Dictionary(t *testing.T) {
+	value := bytes.Repeat(mockDictionary, 4)
+	raw, err := (&repo{compression: CompressFlate, dictionary: mockDictionary}).compress(value)
+	if err != nil {
+		t.Fatalf("compress() error = %s", err)
+	}
+
+	wantErr := errors.Newf("value has been compressed with a different dictionary")
+	if _, err = (&repo{}).decompress(raw); !cmp.Equal(err, wantErr, EquateWeakErrors) {
+		t.Errorf("decompress() without dictionary error = %s", cmp.Diff(wantErr, err, EquateWeakErrors))
+	}
+	if _, err = (&repo{dictionary: []byte("other")}).decompress(raw); !cmp.Equal(err, wantErr, EquateWeakErrors) {
+		t.Errorf("decompress() with other dictionary error = %s", cmp.Diff(wantErr, err, EquateWeakErrors))
+	}
+}
+
+func Test_repo_matchesRaw_Compressed(t *testing.T) {
+	r := &repo{compression: CompressGzip}
+	raw, err := r.encodeItem(&vocab.Object{
+		ID:   "https://example.com/objects/1",
+		Type: vocab.NoteType,
+		URL:  vocab.IRI("https://example.com/" + strings.Repeat("lorem-ipsum/", 20)),
+	})
+	if err != nil {
+		t.Fatalf("encodeItem() error = %s", err)
+	}
+	if raw[0] != tagGzip {
+		t.Fatalf("encodeItem() header = %#x, expected a compressed value", raw[0])
+	}
+	c, data, err := r.codecFor(raw)
+	if err != nil {
+		t.Fatalf("codecFor() error = %s", err)
+	}
+	isNote := func(data []byte) bool {
+		return bytes.Contains(data, []byte(`"type":"Note"`))
+	}
+	isArticle := func(data []byte) bool {
+		return bytes.Contains(data, []byte(`"type":"Article"`))
+	}
+	if !matchesRaw(isNote, c, data) {
+		t.Errorf("matchesRaw() = false, expected the decompressed value to match")
+	}
+	if matchesRaw(isArticle, c, data) {
+		t.Errorf("matchesRaw() = true, expected the decompressed value not to match")
+	}
+}
+
+func Test_repo_MixedCompression(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems, withMetadataJDoe)
+	t.Cleanup(r.Close)
+
+	// NOTE: enabling compression keeps loading the values stored uncompressed
+	r.compression = CompressFlate
+	note := &vocab.Object{
+		ID:   "https://example.com/objects/compressed",
+		Type: vocab.NoteType,
+		URL:  vocab.IRI("https://example.com/" + strings.Repeat("lorem-ipsum/", 20)),
+	}
+	if _, err := r.Save(note); err != nil {
+		t.Fatalf("Save() with compression error = %s", err)
+	}
+	for _, it := range append(mockItems, note) {
+		if vocab.IsIRI(it) {
+			continue
+		}
+		got, err := r.Load(it.GetLink())
+		if err != nil {
+			t.Errorf("Load() of %s error = %s", it.GetLink(), err)
+			continue
+		}
+		if got.GetLink() != it.GetLink() {
+			t.Errorf("Load() of %s returned %s", it.GetLink(), got.GetLink())
+		}
+	}
+	m := new(Metadata)
+	if err := r.LoadMetadata("https://example.com/~jdoe", m); err != nil {
+		t.Errorf("LoadMetadata() of uncompressed metadata error = %s", err)
+	}
+	if err := r.SaveMetadata("https://example.com/~jdoe", m); err != nil {
+		t.Errorf("SaveMetadata() with compression error = %s", err)
+	}
+	if err := r.LoadMetadata("https://example.com/~jdoe", m); err != nil {
+		t.Errorf("LoadMetadata() of compressed metadata error = %s", err)
+	}
+}
@@ -0,0 +1,199 @@
+package boltdb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"slices"
+
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// KeyProvider returns the key-encryption key used for sealing the metadata stored in the database.
+// The key must be 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	EncryptionKey() ([]byte, error)
+}
+
+// StaticKey is a KeyProvider which always returns the same key.
+type StaticKey []byte
+
+func (k StaticKey) EncryptionKey() ([]byte, error) {
+	return k, nil
+}
+
+// NOTE: the sealed values are prefixed with a one byte header, followed by the random GCM nonce and the
+// ciphertext. The values are compressed before being sealed, as the ciphertext doesn't compress.
+// The path of the bucket holding the value is authenticated as additional data, so a sealed value copied
+// to another object's bucket can't be opened.
+const tagAESGCM byte = 0x20
+
+var ErrorMissingEncryptionKey = errors.Newf("value is encrypted, but no encryption key has been configured")
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid encryption key")
+	}
+	return cipher.NewGCM(block)
+}
+
+func (r *repo) encryptionKey() ([]byte, error) {
+	r.keysMu.RLock()
+	keys := r.keys
+	r.keysMu.RUnlock()
+
+	if keys == nil {
+		return nil, nil
+	}
+	key, err := keys.EncryptionKey()
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load encryption key")
+	}
+	return key, nil
+}
+
+// sealingPath returns the bucket path without the empty segments, as used by descendInBucket.
+func sealingPath(path []byte) []byte {
+	segments := bytes.Split(path, pathSeparator)
+	segments = slices.DeleteFunc(segments, func(s []byte) bool { return len(s) == 0 })
+	return bytes.Join(segments, pathSeparator)
+}
+
+func sealWithKey(key, raw, path []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return raw, nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(raw)+aead.Overhead())
+	sealed[0] = tagAESGCM
+	nonce := sealed[1:]
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Annotatef(err, "unable to generate nonce")
+	}
+	return aead.Seal(sealed, nonce, raw, sealingPath(path)), nil
+}
+
+func openWithKey(key, raw, path []byte) ([]byte, error) {
+	if len(raw) == 0 || raw[0] != tagAESGCM {
+		return raw, nil
+	}
+	if len(key) == 0 {
+		return nil, ErrorMissingEncryptionKey
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 1+aead.NonceSize() {
+		return nil, errors.Newf("invalid encrypted value")
+	}
+	nonce, ciphertext := raw[1:1+aead.NonceSize()], raw[1+aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, ciphertext, sealingPath(path))
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to decrypt value, the encryption key is probably wrong")
+	}
+	return data, nil
+}
+
+// seal encrypts the raw value, stored in the bucket at path, with the repository's encryption key,
+// if one has been configured.
+func (r *repo) seal(raw, path []byte) ([]byte, error) {
+	key, err := r.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return sealWithKey(key, raw, path)
+}
+
+// unseal decrypts the raw value, stored in the bucket at path, values which have not been encrypted are returned
+// unchanged.
+func (r *repo) unseal(raw, path []byte) ([]byte, error) {
+	if len(raw) == 0 || raw[0] != tagAESGCM {
+		return raw, nil
+	}
+	key, err := r.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return openWithKey(key, raw, path)
+}
+
+// RotateEncryptionKey re-encrypts all the metadata stored in the database with the newKey, in a single transaction.
+// The metadata which has not been encrypted yet is encrypted, and an empty newKey stores all of it decrypted.
+// After the rotation, the repository uses the newKey, unless it has been configured with a KeyProvider, other than
+// a StaticKey, which is kept: the provider is responsible for returning the newKey from then on.
+// The rotation is not appended to the changelog, so the replicas need to be bootstrapped again.
+// The metadata loaded concurrently with the rotation can fail to decrypt, while the key is being switched.
+func (r *repo) RotateEncryptionKey(oldKey, newKey []byte) error {
+	if r == nil || r.d == nil {
+		return errNotOpen
+	}
+	if len(newKey) > 0 {
+		if _, err := newAEAD(newKey); err != nil {
+			return err
+		}
+	}
+	var restore func()
+	err := r.update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return ErrorInvalidRoot(r.root)
+		}
+		for _, path := range bucketPathsWithKey(root, []byte(metaDataKey)) {
+			b := bucketAtPath(root, path)
+			if b == nil {
+				continue
+			}
+			p := bytes.Join(path, pathSeparator)
+			raw, err := openWithKey(oldKey, b.Get([]byte(metaDataKey)), p)
+			if err != nil {
+				return errors.Annotatef(err, "unable to decrypt metadata of %s", p)
+			}
+			if raw, err = sealWithKey(newKey, raw, p); err != nil {
+				return err
+			}
+			if err = b.Put([]byte(metaDataKey), raw); err != nil {
+				return errors.Annotatef(err, "unable to save metadata")
+			}
+		}
+		if err := changelogIncomplete(root); err != nil {
+			return err
+		}
+		// NOTE: we switch the key while holding the write lock of the database, so no concurrent write can
+		// seal a value with the old one after the rotation.
+		restore = r.switchEncryptionKey(newKey)
+		return nil
+	})
+	if err != nil && restore != nil {
+		restore()
+	}
+	return err
+}
+
+// switchEncryptionKey makes the repository use the newKey, and returns a function restoring the previous key.
+// Custom key providers are kept.
+func (r *repo) switchEncryptionKey(newKey []byte) func() {
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	prev := r.keys
+	if _, static := prev.(StaticKey); prev != nil && !static {
+		return func() {}
+	}
+	r.keys = nil
+	if len(newKey) > 0 {
+		r.keys = StaticKey(newKey)
+	}
+	return func() {
+		r.keysMu.Lock()
+		defer r.keysMu.Unlock()
+		r.keys = prev
+	}
+}
@@ -0,0 +1,256 @@
+package boltdb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"fmt"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	mockKey      = bytes.Repeat([]byte{0x42}, 32)
+	mockOtherKey = bytes.Repeat([]byte{0x24}, 16)
+)
+
+func withEncryptionKey(key []byte) initFn {
+	return func(t *testing.T, r *repo) *repo {
+		r.keys = StaticKey(key)
+		return r
+	}
+}
+
+func rawMetadata(t *testing.T, r *repo, iri vocab.IRI) []byte {
+	var raw []byte
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b, _, err := descendInBucket(tx.Bucket(r.root), itemBucketPath(iri), false)
+		if err != nil {
+			return err
+		}
+		raw = bytes.Clone(b.Get([]byte(metaDataKey)))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to load raw metadata of %s: %s", iri, err)
+	}
+	return raw
+}
+
+func Test_sealWithKey(t *testing.T) {
+	value := []byte(`{"pw":"secret"}`)
+	path := []byte("example.com/~jdoe")
+	tests := []struct {
+		name     string
+		sealKey  []byte
+		openKey  []byte
+		openPath []byte
+		want     []byte
+		wantErr  error
+	}{
+		{
+			name: "no key",
+			want: value,
+		},
+		{
+			name:    "same key",
+			sealKey: mockKey,
+			openKey: mockKey,
+			want:    value,
+		},
+		{
+			name:    "missing key",
+			sealKey: mockKey,
+			wantErr: ErrorMissingEncryptionKey,
+		},
+		{
+			name:    "wrong key",
+			sealKey: mockKey,
+			openKey: mockOtherKey,
+			wantErr: errors.Annotatef(fmt.Errorf("cipher: message authentication failed"), "unable to decrypt value, the encryption key is probably wrong"),
+		},
+		{
+			name:     "same path, with different separators",
+			sealKey:  mockKey,
+			openKey:  mockKey,
+			openPath: []byte("/example.com//~jdoe/"),
+			want:     value,
+		},
+		{
+			name:     "moved to another path",
+			sealKey:  mockKey,
+			openKey:  mockKey,
+			openPath: []byte("example.com/~alice"),
+			wantErr:  errors.Annotatef(fmt.Errorf("cipher: message authentication failed"), "unable to decrypt value, the encryption key is probably wrong"),
+		},
+		{
+			name:    "invalid key",
+			sealKey: []byte("short"),
+			wantErr: errors.Annotatef(aes.KeySizeError(5), "invalid encryption key"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := sealWithKey(tt.sealKey, value, path)
+			if err == nil {
+				if len(tt.sealKey) > 0 && (sealed[0] != tagAESGCM || bytes.Contains(sealed, value)) {
+					t.Errorf("sealWithKey() = %q, expected an encrypted value", sealed)
+				}
+				var got []byte
+				openPath := tt.openPath
+				if openPath == nil {
+					openPath = path
+				}
+				got, err = openWithKey(tt.openKey, sealed, openPath)
+				if err == nil && !bytes.Equal(got, tt.want) {
+					t.Errorf("openWithKey() = %s", cmp.Diff(string(tt.want), string(got)))
+				}
+			}
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("sealWithKey() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+		})
+	}
+}
+
+func Test_New_EncryptionKey(t *testing.T) {
+	if _, err := New(Config{Path: t.TempDir(), EncryptionKey: []byte("short")}); err == nil {
+		t.Errorf("New() with an invalid encryption key didn't return an error")
+	}
+	r, err := New(Config{Path: t.TempDir(), EncryptionKey: mockKey})
+	if err != nil {
+		t.Fatalf("New() error = %s", err)
+	}
+	if key, _ := r.encryptionKey(); !bytes.Equal(key, mockKey) {
+		t.Errorf("New() encryption key = %v, want %v", key, mockKey)
+	}
+}
+
+func Test_repo_SaveMetadata_Encrypted(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withEncryptionKey(mockKey), withMockItems, withMetadataJDoe)
+	t.Cleanup(r.Close)
+
+	raw := rawMetadata(t, r, "https://example.com/~jdoe")
+	if raw[0] != tagAESGCM || bytes.Contains(raw, []byte("PRIVATE KEY")) {
+		t.Errorf("stored metadata is not encrypted")
+	}
+	if _, err := r.LoadKey("https://example.com/~jdoe"); err != nil {
+		t.Errorf("LoadKey() error = %s", err)
+	}
+
+	r.keys = nil
+	m := new(Metadata)
+	if err := r.LoadMetadata("https://example.com/~jdoe", m); !cmp.Equal(err, ErrorMissingEncryptionKey, EquateWeakErrors) {
+		t.Errorf("LoadMetadata() without key error = %s", cmp.Diff(ErrorMissingEncryptionKey, err, EquateWeakErrors))
+	}
+}
+
+func Test_repo_RotateEncryptionKey(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems, withMetadataJDoe)
+	t.Cleanup(r.Close)
+
+	iri := vocab.IRI("https://example.com/~jdoe")
+	steps := []struct {
+		name    string
+		old     []byte
+		new     []byte
+		wantErr error
+	}{
+		{
+			name: "encrypt plain metadata",
+			new:  mockKey,
+		},
+		{
+			name:    "wrong old key",
+			old:     mockOtherKey,
+			new:     mockKey,
+			wantErr: errors.Newf("unable to decrypt metadata of example.com/~jdoe"),
+		},
+		{
+			name: "rotate to other key",
+			old:  mockKey,
+			new:  mockOtherKey,
+		},
+		{
+			name: "decrypt",
+			old:  mockOtherKey,
+		},
+	}
+	for _, tt := range steps {
+		err := r.RotateEncryptionKey(tt.old, tt.new)
+		if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+			t.Fatalf("%s: RotateEncryptionKey() error = %s", tt.name, cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+		}
+		if err != nil {
+			continue
+		}
+		raw := rawMetadata(t, r, iri)
+		if encrypted := raw[0] == tagAESGCM; encrypted != (len(tt.new) > 0) {
+			t.Errorf("%s: stored metadata encrypted = %t", tt.name, encrypted)
+		}
+		got, err := r.LoadKey(iri)
+		if err != nil {
+			t.Errorf("%s: LoadKey() error = %s", tt.name, err)
+		}
+		if !cmp.Equal(got, pk) {
+			t.Errorf("%s: LoadKey() diff = %s", tt.name, cmp.Diff(pk, got))
+		}
+	}
+}
+
+type keyFn func() ([]byte, error)
+
+func (k keyFn) EncryptionKey() ([]byte, error) {
+	return k()
+}
+
+func Test_repo_switchEncryptionKey(t *testing.T) {
+	provider := keyFn(func() ([]byte, error) { return mockKey, nil })
+	tests := []struct {
+		name    string
+		keys    KeyProvider
+		newKey  []byte
+		wantKey []byte
+	}{
+		{
+			name:    "no key",
+			newKey:  mockKey,
+			wantKey: mockKey,
+		},
+		{
+			name:    "static key",
+			keys:    StaticKey(mockOtherKey),
+			newKey:  mockKey,
+			wantKey: mockKey,
+		},
+		{
+			name:    "static key, to decrypted",
+			keys:    StaticKey(mockKey),
+			wantKey: nil,
+		},
+		{
+			name:    "key provider is kept",
+			keys:    provider,
+			newKey:  mockOtherKey,
+			wantKey: mockKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &repo{keys: tt.keys}
+			prevKey, _ := r.encryptionKey()
+
+			restore := r.switchEncryptionKey(tt.newKey)
+			if key, _ := r.encryptionKey(); !bytes.Equal(key, tt.wantKey) {
+				t.Errorf("switchEncryptionKey() key = %v, want %v", key, tt.wantKey)
+			}
+			restore()
+			if key, _ := r.encryptionKey(); !bytes.Equal(key, prevKey) {
+				t.Errorf("switchEncryptionKey() restored key = %v, want %v", key, prevKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package boltdb
+
+import (
+	"slices"
+	"sync"
+
+	vocab "github.com/go-ap/activitypub"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Operation is the kind of change an Event describes.
+type Operation string
+
+const (
+	OpSave         Operation = "save"
+	OpAddTo        Operation = "add-to"
+	OpRemoveFrom   Operation = "remove-from"
+	OpDelete       Operation = "delete"
+	OpSaveMetadata Operation = "save-metadata"
+)
+
+// Event describes a change made to the storage.
+// For OpAddTo and OpRemoveFrom the Collection is the IRI of the collection the IRI has been added to,
+// or removed from.
+type Event struct {
+	Op         Operation
+	IRI        vocab.IRI
+	Collection vocab.IRI
+	// Missed is the number of events which have been dropped for the subscriber before this one,
+	// because its buffer was full.
+	Missed uint64
+}
+
+// EventFilter selects the events a subscriber receives, a nil filter selects all of them.
+type EventFilter func(Event) bool
+
+// subscriberBuffer is the number of events buffered for every subscriber.
+const subscriberBuffer = 256
+
+type subscriber struct {
+	ch      chan Event
+	filter  EventFilter
+	dropped uint64
+}
+
+type eventBus struct {
+	mu sync.Mutex
+	// NOTE: the subscribers are kept in a slice, as the package's delete function shadows the builtin
+	subs []*subscriber
+}
+
+func (e *eventBus) subscribe(filter EventFilter) *subscriber {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := &subscriber{ch: make(chan Event, subscriberBuffer), filter: filter}
+	e.subs = append(e.subs, s)
+	return s
+}
+
+func (e *eventBus) unsubscribe(s *subscriber) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, sub := range e.subs {
+		if sub == s {
+			e.subs = slices.Delete(e.subs, i, i+1)
+			close(s.ch)
+			return
+		}
+	}
+}
+
+func (e *eventBus) closeAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range e.subs {
+		close(s.ch)
+	}
+	e.subs = nil
+}
+
+func (e *eventBus) active() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.subs) > 0
+}
+
+// publish sends ev to all the matching subscribers, without blocking.
+// NOTE: when the buffer of a subscriber is full the event is dropped, so a slow subscriber never blocks
+// the writes. The number of dropped events is reported in the Missed field of the next event it receives.
+func (e *eventBus) publish(ev Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range e.subs {
+		if s.filter != nil && !s.filter(ev) {
+			continue
+		}
+		ev.Missed = s.dropped
+		select {
+		case s.ch <- ev:
+			s.dropped = 0
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// emit publishes ev to the subscribers after the tx transaction is committed successfully.
+func (r *repo) emit(tx *bolt.Tx, ev Event) {
+	if !r.events.active() {
+		return
+	}
+	tx.OnCommit(func() {
+		r.events.publish(ev)
+	})
+}
+
+// Subscribe returns a channel receiving the events matching the filter, for all the changes committed after
+// the call. The events are buffered, and when the buffer is full the new events are dropped instead of
+// blocking the writes, see Event.Missed.
+// The cancel function stops the subscription and closes the channel, which is also closed when the repository
+// gets closed.
+func (r *repo) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	s := r.events.subscribe(filter)
+	once := sync.Once{}
+	return s.ch, func() {
+		once.Do(func() {
+			r.events.unsubscribe(s)
+		})
+	}
+}
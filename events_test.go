@@ -0,0 +1,133 @@
+package boltdb
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func receiveEvents(ch <-chan Event) []Event {
+	events := make([]Event, 0)
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func Test_repo_Subscribe(t *testing.T) {
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	colIRI := vocab.IRI("https://example.com/outbox")
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   []Event
+	}{
+		{
+			name: "all",
+			want: []Event{
+				{Op: OpSave, IRI: note.ID},
+				{Op: OpAddTo, IRI: note.ID, Collection: colIRI},
+				{Op: OpSaveMetadata, IRI: note.ID},
+				{Op: OpRemoveFrom, IRI: note.ID, Collection: colIRI},
+				{Op: OpDelete, IRI: note.ID},
+			},
+		},
+		{
+			name: "collection changes",
+			filter: func(ev Event) bool {
+				return ev.Collection == colIRI
+			},
+			want: []Event{
+				{Op: OpAddTo, IRI: note.ID, Collection: colIRI},
+				{Op: OpRemoveFrom, IRI: note.ID, Collection: colIRI},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI))
+			t.Cleanup(r.Close)
+
+			events, cancel := r.Subscribe(tt.filter)
+			defer cancel()
+
+			if _, err := r.Save(note); err != nil {
+				t.Fatalf("Save() error = %s", err)
+			}
+			if err := r.AddTo(colIRI, note); err != nil {
+				t.Fatalf("AddTo() error = %s", err)
+			}
+			if err := r.SaveMetadata(note.ID, &Metadata{Pw: defaultPw}); err != nil {
+				t.Fatalf("SaveMetadata() error = %s", err)
+			}
+			if err := r.RemoveFrom(colIRI, note); err != nil {
+				t.Fatalf("RemoveFrom() error = %s", err)
+			}
+			if err := r.Delete(note); err != nil {
+				t.Fatalf("Delete() error = %s", err)
+			}
+			if got := receiveEvents(events); !cmp.Equal(got, tt.want) {
+				t.Errorf("Subscribe() events %s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func Test_repo_Subscribe_Rollback(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap)
+	t.Cleanup(r.Close)
+
+	events, cancel := r.Subscribe(nil)
+	defer cancel()
+
+	errAbort := errors.Newf("abort")
+	err := r.Tx(func(tx Tx) error {
+		if _, err := tx.Save(&vocab.Object{ID: "https://example.com/objects/1"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Tx() error = %v, want %v", err, errAbort)
+	}
+	if got := receiveEvents(events); len(got) > 0 {
+		t.Errorf("Subscribe() received events for a rolled back transaction: %v", got)
+	}
+}
+
+func Test_eventBus_publish(t *testing.T) {
+	bus := eventBus{}
+	slow := bus.subscribe(nil)
+	ev := Event{Op: OpSave, IRI: "https://example.com/objects/1"}
+
+	extra := 10
+	for i := 0; i < subscriberBuffer+extra; i++ {
+		bus.publish(ev)
+	}
+	if got := len(receiveEvents(slow.ch)); got != subscriberBuffer {
+		t.Errorf("publish() buffered %d events, want %d", got, subscriberBuffer)
+	}
+	bus.publish(ev)
+	got := receiveEvents(slow.ch)
+	if len(got) != 1 || got[0].Missed != uint64(extra) {
+		t.Errorf("publish() after dropping events = %v, want one event with %d missed", got, extra)
+	}
+
+	bus.unsubscribe(slow)
+	if _, ok := <-slow.ch; ok {
+		t.Errorf("unsubscribe() didn't close the channel")
+	}
+	// NOTE: publishing without subscribers and unsubscribing twice are no-ops
+	bus.publish(ev)
+	bus.unsubscribe(slow)
+}
@@ -0,0 +1,275 @@
+package boltdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// RecordKind is the kind of value a Record holds.
+type RecordKind string
+
+const (
+	KindObject     RecordKind = "object"
+	KindCollection RecordKind = "collection"
+	KindMetadata   RecordKind = "metadata"
+	KindClient     RecordKind = "client"
+	KindAuthorize  RecordKind = "authorize"
+	KindAccess     RecordKind = "access"
+	KindRefresh    RecordKind = "refresh"
+)
+
+// Record is one line of the NDJSON stream written by Export.
+// The Path is the path of the bucket holding the value, or the key for the OAuth2 data, and the Payload
+// is the value encoded as JSON, irrespective of the codec used for storing it.
+// The collection payloads list all their members as items.
+type Record struct {
+	Path    string          `json:"path"`
+	Kind    RecordKind      `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// importBatchSize is the number of records Import saves in a single transaction.
+const importBatchSize = 1000
+
+var osinBuckets = []struct {
+	kind   RecordKind
+	bucket string
+	newFn  func() any
+}{
+	{kind: KindClient, bucket: clientsBucket, newFn: func() any { return new(cl) }},
+	{kind: KindAuthorize, bucket: authorizeBucket, newFn: func() any { return new(auth) }},
+	{kind: KindAccess, bucket: accessBucket, newFn: func() any { return new(acc) }},
+	{kind: KindRefresh, bucket: refreshBucket, newFn: func() any { return new(ref) }},
+}
+
+// jsonPayload returns the stored raw value as JSON, decoding it into v first if it was stored with another codec.
+func (r *repo) jsonPayload(raw []byte, v any) (json.RawMessage, error) {
+	c, data, err := r.codecFor(raw)
+	if err != nil {
+		return nil, err
+	}
+	if c.Tag() == tagJSON {
+		return bytes.TrimSpace(data), nil
+	}
+	if err = c.Decode(data, v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// payloadValue returns the value to be stored for the JSON payload. For the JSON codec it's the payload itself,
+// which keeps all its fields, for the other codecs it's the payload decoded into v.
+func (r *repo) payloadValue(payload json.RawMessage, v any) (any, error) {
+	if r.valueCodec().Tag() == tagJSON {
+		return payload, nil
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (r *repo) itemRecord(path string, b *bolt.Bucket, raw []byte) (Record, error) {
+	rec := Record{Path: path, Kind: KindObject}
+	it, err := r.decodeItem(raw)
+	if err != nil {
+		return rec, err
+	}
+	if vocab.IsCollection(it) {
+		rec.Kind = KindCollection
+		_ = onCollectionHeader(it, func(items *vocab.ItemCollection, _ *uint) {
+			*items = collectionMembers(b)
+		})
+	}
+	rec.Payload, err = encodeItemFn(it)
+	return rec, err
+}
+
+// Export writes all the objects, collections, metadata and OAuth2 data in the database to w,
+// as one JSON Record per line.
+// NOTE: the metadata is exported decrypted, so the output needs to be protected accordingly.
+func (r *repo) Export(w io.Writer) error {
+	if r == nil || r.d == nil {
+		return errNotOpen
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+
+	err := r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return ErrorInvalidRoot(r.root)
+		}
+		err := walkItemBuckets(root, func(path [][]byte, b *bolt.Bucket) error {
+			p := string(bytes.Join(path, pathSeparator))
+			if raw := b.Get([]byte(objectKey)); raw != nil {
+				rec, err := r.itemRecord(p, b, raw)
+				if err != nil {
+					return errors.Annotatef(err, "unable to export %s", p)
+				}
+				if err = enc.Encode(rec); err != nil {
+					return err
+				}
+			}
+			if raw := b.Get([]byte(metaDataKey)); raw != nil {
+				raw, err := r.unseal(raw, []byte(p))
+				if err != nil {
+					return errors.Annotatef(err, "unable to export metadata of %s", p)
+				}
+				payload, err := r.jsonPayload(raw, new(Metadata))
+				if err != nil {
+					return errors.Annotatef(err, "unable to export metadata of %s", p)
+				}
+				if err = enc.Encode(Record{Path: p, Kind: KindMetadata, Payload: payload}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, ob := range osinBuckets {
+			b := root.Bucket([]byte(ob.bucket))
+			if b == nil {
+				continue
+			}
+			err = b.ForEach(func(k, raw []byte) error {
+				payload, err := r.jsonPayload(raw, ob.newFn())
+				if err != nil {
+					return errors.Annotatef(err, "unable to export %s %s", ob.kind, k)
+				}
+				return enc.Encode(Record{Path: string(k), Kind: ob.kind, Payload: payload})
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (r *repo) importRecord(tx *bolt.Tx, rec Record) error {
+	root, err := rootFromTx(tx, r.root)
+	if err != nil {
+		return err
+	}
+	switch rec.Kind {
+	case KindObject:
+		it, err := decodeItemFn(rec.Payload)
+		if err != nil {
+			return err
+		}
+		return saveTx(r, tx, it)
+	case KindCollection:
+		col, err := decodeItemFn(rec.Payload)
+		if err != nil {
+			return err
+		}
+		var members vocab.ItemCollection
+		_ = onCollectionHeader(col, func(items *vocab.ItemCollection, _ *uint) {
+			members = *items
+			*items = nil
+		})
+		if err = saveTx(r, tx, col); err != nil {
+			return err
+		}
+		b, _, err := descendInBucket(root, itemBucketPath(col.GetLink()), true)
+		if err != nil {
+			return err
+		}
+		for _, it := range members {
+			if _, err = appendToCollectionBucket(b, it.GetLink()); err != nil {
+				return err
+			}
+			if err = addMembership(root, col.GetLink(), it.GetLink()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case KindMetadata:
+		m, err := r.payloadValue(rec.Payload, new(Metadata))
+		if err != nil {
+			return err
+		}
+		b, _, err := descendInBucket(root, []byte(rec.Path), true)
+		if err != nil {
+			return err
+		}
+		return r.saveMetadataInBucket(b, []byte(rec.Path), m)
+	}
+	for _, ob := range osinBuckets {
+		if ob.kind != rec.Kind {
+			continue
+		}
+		v, err := r.payloadValue(rec.Payload, ob.newFn())
+		if err != nil {
+			return err
+		}
+		raw, err := r.encode(v)
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(ob.bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(rec.Path), raw)
+	}
+	return errors.Newf("unknown record kind %q", rec.Kind)
+}
+
+// Import saves all the records read from rd, in the format written by Export, in the database.
+// The records are saved in batches, each one in its own transaction.
+func (r *repo) Import(rd io.Reader) error {
+	if r == nil || r.d == nil {
+		return errNotOpen
+	}
+	dec := json.NewDecoder(bufio.NewReader(rd))
+
+	line := 0
+	batch := make([]Record, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		start := line - len(batch)
+		err := r.update(func(tx *bolt.Tx) error {
+			for i, rec := range batch {
+				if err := r.importRecord(tx, rec); err != nil {
+					return errors.Annotatef(err, "unable to import record %d, %s %s", start+i+1, rec.Kind, rec.Path)
+				}
+			}
+			return nil
+		})
+		batch = batch[:0]
+		return err
+	}
+	for {
+		rec := Record{}
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return errors.Annotatef(err, "invalid record %d", line+1)
+		}
+		line++
+		if batch = append(batch, rec); len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
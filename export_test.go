@@ -0,0 +1,107 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func exportRecords(t *testing.T, r *repo) []byte {
+	buf := bytes.Buffer{}
+	if err := r.Export(&buf); err != nil {
+		t.Fatalf("Export() error = %s", err)
+	}
+	return buf.Bytes()
+}
+
+func Test_repo_Export(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems, withMetadataJDoe, withOrderedCollectionHavingItems, withClient)
+	t.Cleanup(r.Close)
+
+	kinds := make(map[RecordKind]int)
+	for _, line := range bytes.Split(bytes.TrimSpace(exportRecords(t, r)), []byte{'\n'}) {
+		rec := Record{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatalf("invalid record %s: %s", line, err)
+		}
+		kinds[rec.Kind]++
+		if rec.Kind == KindCollection && rec.Path == "example.com/followers" {
+			col, err := decodeItemFn(rec.Payload)
+			if err != nil {
+				t.Fatalf("invalid collection payload %s: %s", rec.Payload, err)
+			}
+			want := vocab.ItemCollection{vocab.IRI("https://example.com")}
+			_ = onCollectionHeader(col, func(items *vocab.ItemCollection, _ *uint) {
+				if !vocab.ItemsEqual(*items, want) {
+					t.Errorf("Export() collection members = %v, want %v", *items, want)
+				}
+			})
+		}
+	}
+	for _, kind := range []RecordKind{KindObject, KindCollection, KindMetadata, KindClient} {
+		if kinds[kind] == 0 {
+			t.Errorf("Export() wrote no %s records", kind)
+		}
+	}
+}
+
+func Test_repo_Import(t *testing.T) {
+	src := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems, withMetadataJDoe, withOrderedCollectionHavingItems, withClient)
+	t.Cleanup(src.Close)
+	exported := exportRecords(t, src)
+
+	dst := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap)
+	t.Cleanup(dst.Close)
+	if err := dst.Import(bytes.NewReader(exported)); err != nil {
+		t.Fatalf("Import() error = %s", err)
+	}
+
+	if got := exportRecords(t, dst); !bytes.Equal(got, exported) {
+		t.Errorf("Export() of the imported database differs %s", cmp.Diff(string(exported), string(got)))
+	}
+	if _, err := dst.LoadKey("https://example.com/~jdoe"); err != nil {
+		t.Errorf("LoadKey() from imported db error = %s", err)
+	}
+	if _, err := dst.GetClient(defaultClient.Id); err != nil {
+		t.Errorf("GetClient() from imported db error = %s", err)
+	}
+	cols, err := dst.ContainedIn("https://example.com")
+	if err != nil || len(cols) != 1 {
+		t.Errorf("ContainedIn() from imported db = %v, %v", cols, err)
+	}
+}
+
+func Test_repo_Import_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{
+			name:    "not JSON",
+			input:   "not json",
+			wantErr: errors.Newf("invalid record 1"),
+		},
+		{
+			name:    "unknown kind",
+			input:   `{"path":"example.com","kind":"unknown","payload":{}}`,
+			wantErr: errors.Newf("unable to import record 1, unknown example.com"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap)
+			t.Cleanup(r.Close)
+
+			err := r.Import(strings.NewReader(tt.input))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr.Error()) {
+				t.Errorf("Import() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// NOTE: when the history is enabled, the previous versions of an object are kept in the __history
+// sub-bucket of the object's bucket. The keys are the big endian timestamps of the moment the version got replaced,
+// and the values are the encoded versions, exactly as they were stored in __raw.
+// The bucket sequence is used as a counter of the stored revisions.
+const historyBucket = "__history"
+
+func revisionKey(t time.Time) []byte {
+	return itob(uint64(t.UTC().UnixNano()))
+}
+
+// saveRevision copies the current version of the object stored in bucket b to its history,
+// before it gets replaced by it.
+func (r *repo) saveRevision(b *bolt.Bucket, it vocab.Item) error {
+	if !r.keepHistory {
+		return nil
+	}
+	old := b.Get([]byte(objectKey))
+	if old == nil {
+		return nil
+	}
+	if raw, err := r.encodeItem(it); err == nil && bytes.Equal(raw, old) {
+		return nil
+	}
+	hb, err := b.CreateBucketIfNotExists([]byte(historyBucket))
+	if err != nil {
+		return errors.Annotatef(err, "could not create history bucket")
+	}
+	key := revisionKey(time.Now())
+	for hb.Get(key) != nil {
+		key = itob(binary.BigEndian.Uint64(key) + 1)
+	}
+	if err = hb.Put(key, bytes.Clone(old)); err != nil {
+		return errors.Annotatef(err, "could not store revision of %s", it.GetLink())
+	}
+	if err = hb.SetSequence(hb.Sequence() + 1); err != nil {
+		return err
+	}
+	return trimRevisions(hb, r.maxRevisions)
+}
+
+// trimRevisions removes the oldest revisions from the history bucket until at most maxRevisions are left.
+// A maxRevisions value lower than 1 keeps all of them.
+func trimRevisions(hb *bolt.Bucket, maxRevisions int) error {
+	if maxRevisions < 1 {
+		return nil
+	}
+	c := hb.Cursor()
+	for k, _ := c.First(); k != nil && hb.Sequence() > uint64(maxRevisions); k, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return errors.Annotatef(err, "could not remove old revision")
+		}
+		if err := hb.SetSequence(hb.Sequence() - 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func objectBucket(tx *bolt.Tx, root []byte, iri vocab.IRI) (*bolt.Bucket, error) {
+	rb := tx.Bucket(root)
+	if rb == nil {
+		return nil, ErrorInvalidRoot(root)
+	}
+	b, remainder, err := descendInBucket(rb, itemBucketPath(iri), false)
+	if err != nil || len(remainder) > 0 || b.Get([]byte(objectKey)) == nil {
+		return nil, errors.NotFoundf("%s not found", iri)
+	}
+	return b, nil
+}
+
+// LoadRevisions returns all the stored versions of the object identified by iri, oldest first.
+// The last element is the current version.
+func (r *repo) LoadRevisions(iri vocab.IRI) (vocab.ItemCollection, error) {
+	if r == nil || r.d == nil {
+		return nil, errNotOpen
+	}
+	revisions := make(vocab.ItemCollection, 0)
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b, err := objectBucket(tx, r.root, iri)
+		if err != nil {
+			return err
+		}
+		if hb := b.Bucket([]byte(historyBucket)); hb != nil {
+			err = hb.ForEach(func(_, raw []byte) error {
+				it, err := r.decodeItem(raw)
+				if err != nil {
+					return errors.Annotatef(err, "could not unmarshal revision of %s", iri)
+				}
+				revisions = append(revisions, it)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		it, err := r.loadRawItemFromBucket(b)
+		if err != nil {
+			return err
+		}
+		revisions = append(revisions, it)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// LoadAt returns the version of the object identified by iri which was current at the when moment.
+func (r *repo) LoadAt(iri vocab.IRI, when time.Time) (vocab.Item, error) {
+	if r == nil || r.d == nil {
+		return nil, errNotOpen
+	}
+	var it vocab.Item
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b, err := objectBucket(tx, r.root, iri)
+		if err != nil {
+			return err
+		}
+		raw := b.Get([]byte(objectKey))
+		if hb := b.Bucket([]byte(historyBucket)); hb != nil {
+			// NOTE: the first revision replaced after the when moment is the one that was current at that time
+			if k, v := hb.Cursor().Seek(itob(binary.BigEndian.Uint64(revisionKey(when)) + 1)); k != nil {
+				raw = v
+			}
+		}
+		if it, err = r.decodeItem(raw); err != nil {
+			return errors.Annotatef(err, "could not unmarshal %s", iri)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pub := itemIndexKeys(it).Published; !pub.IsZero() && pub.After(when) {
+		return nil, errors.NotFoundf("%s was not published at %s", iri, when.Format(time.RFC3339))
+	}
+	return it, nil
+}
@@ -0,0 +1,148 @@
+package boltdb
+
+import (
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func withHistory(maxRevisions int) initFn {
+	return func(_ *testing.T, r *repo) *repo {
+		r.keepHistory = true
+		r.maxRevisions = maxRevisions
+		return r
+	}
+}
+
+func noteRevision(content string) *vocab.Object {
+	return &vocab.Object{
+		ID:        "https://example.com/objects/history",
+		Type:      vocab.NoteType,
+		Published: publishedTime,
+		Content:   vocab.DefaultNaturalLanguage(content),
+	}
+}
+
+func Test_repo_LoadRevisions(t *testing.T) {
+	tests := []struct {
+		name         string
+		setupFns     []initFn
+		saves        []string
+		want         []string
+		wantErr      error
+		maxRevisions int
+	}{
+		{
+			name:    "not open",
+			wantErr: errNotOpen,
+		},
+		{
+			name:     "not found",
+			setupFns: []initFn{withOpenRoot, withBootstrap},
+			wantErr:  errors.NotFoundf("https://example.com/objects/history not found"),
+		},
+		{
+			name:     "history disabled",
+			setupFns: []initFn{withOpenRoot, withBootstrap},
+			saves:    []string{"v1", "v2"},
+			want:     []string{"v2"},
+		},
+		{
+			name:     "all revisions",
+			setupFns: []initFn{withOpenRoot, withBootstrap, withHistory(0)},
+			saves:    []string{"v1", "v2", "v3"},
+			want:     []string{"v1", "v2", "v3"},
+		},
+		{
+			name:     "saving the same version doesn't add a revision",
+			setupFns: []initFn{withOpenRoot, withBootstrap, withHistory(0)},
+			saves:    []string{"v1", "v1", "v2"},
+			want:     []string{"v1", "v2"},
+		},
+		{
+			name:     "retention limit",
+			setupFns: []initFn{withOpenRoot, withBootstrap, withHistory(2)},
+			saves:    []string{"v1", "v2", "v3", "v4"},
+			want:     []string{"v2", "v3", "v4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, fields{path: t.TempDir()}, tt.setupFns...)
+			t.Cleanup(r.Close)
+
+			for _, content := range tt.saves {
+				if _, err := r.Save(noteRevision(content)); err != nil {
+					t.Fatalf("Save() error = %s", err)
+				}
+			}
+			got, err := r.LoadRevisions(noteRevision("").ID)
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("LoadRevisions() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+			var want vocab.ItemCollection
+			for _, content := range tt.want {
+				want = append(want, noteRevision(content))
+			}
+			if !cmp.Equal(got, want, EquateItemCollections) {
+				t.Errorf("LoadRevisions() = %s", cmp.Diff(want, got, EquateItemCollections))
+			}
+		})
+	}
+}
+
+func Test_repo_LoadAt(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withHistory(0))
+	t.Cleanup(r.Close)
+
+	moments := make([]time.Time, 0)
+	for _, content := range []string{"v1", "v2", "v3"} {
+		if _, err := r.Save(noteRevision(content)); err != nil {
+			t.Fatalf("Save() error = %s", err)
+		}
+		moments = append(moments, time.Now())
+		time.Sleep(time.Millisecond)
+	}
+
+	tests := []struct {
+		name    string
+		when    time.Time
+		want    vocab.Item
+		wantErr error
+	}{
+		{
+			name:    "before publishing",
+			when:    publishedTime.Add(-time.Hour),
+			wantErr: errors.NotFoundf("https://example.com/objects/history was not published at %s", publishedTime.Add(-time.Hour).Format(time.RFC3339)),
+		},
+		{
+			name: "first version",
+			when: moments[0],
+			want: noteRevision("v1"),
+		},
+		{
+			name: "second version",
+			when: moments[1],
+			want: noteRevision("v2"),
+		},
+		{
+			name: "current version",
+			when: time.Now(),
+			want: noteRevision("v3"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.LoadAt(noteRevision("").ID, tt.when)
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("LoadAt() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+			if !vocab.ItemsEqual(got, tt.want) {
+				t.Errorf("LoadAt() = %s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,592 @@
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	bolt "go.etcd.io/bbolt"
+)
+
+// NOTE: the secondary indexes live in the __index bucket under the root bucket.
+// The type, actor and object indexes contain one bucket per indexed value, holding the IRIs of the matching items
+// as keys, and using the bucket sequence as a counter of its keys.
+// The published index is a flat bucket with keys composed of the big endian timestamp, followed by the item IRI.
+// The __docs bucket keeps the values every item was indexed with, so we can remove them when it gets updated or deleted.
+const (
+	indexBucket = "__index"
+
+	indexType      = "type"
+	indexActor     = "actor"
+	indexObject    = "object"
+	indexPublished = "published"
+	indexDocs      = "__docs"
+)
+
+var indexMark = []byte{1}
+
+type indexKeys struct {
+	Types     []string    `json:"type,omitempty"`
+	Actors    []vocab.IRI `json:"actor,omitempty"`
+	Objects   []vocab.IRI `json:"object,omitempty"`
+	Published time.Time   `json:"published,omitzero"`
+}
+
+func typesOf(typ vocab.Typer) []string {
+	if tt, ok := typ.(vocab.ActivityVocabularyType); ok && tt != "" {
+		return []string{string(tt)}
+	}
+	types := make([]string, 0)
+	if tt, ok := typ.(vocab.ActivityVocabularyTypes); ok {
+		for _, t := range tt {
+			if t != "" {
+				types = append(types, string(t))
+			}
+		}
+	}
+	return types
+}
+
+func linksOf(it vocab.Item) []vocab.IRI {
+	if vocab.IsNil(it) {
+		return nil
+	}
+	if col, ok := it.(vocab.ItemCollection); ok {
+		iris := make([]vocab.IRI, 0, len(col))
+		for _, i := range col {
+			if !vocab.IsNil(i) {
+				iris = append(iris, i.GetLink())
+			}
+		}
+		return iris
+	}
+	return []vocab.IRI{it.GetLink()}
+}
+
+// itemIndexKeys returns the values the item gets indexed with.
+func itemIndexKeys(it vocab.Item) indexKeys {
+	k := indexKeys{}
+	if vocab.IsNil(it) || vocab.IsIRI(it) {
+		return k
+	}
+	typ := it.GetType()
+	if typ == nil {
+		return k
+	}
+	k.Types = typesOf(typ)
+	if vocab.ObjectTypes.Match(typ) || vocab.ActorTypes.Match(typ) || vocab.ActivityTypes.Match(typ) || vocab.IntransitiveActivityTypes.Match(typ) {
+		_ = vocab.OnObject(it, func(o *vocab.Object) error {
+			k.Published = o.Published
+			k.Actors = append(k.Actors, linksOf(o.AttributedTo)...)
+			return nil
+		})
+	}
+	if vocab.IntransitiveActivityTypes.Match(typ) || vocab.ActivityTypes.Match(typ) {
+		_ = vocab.OnIntransitiveActivity(it, func(a *vocab.IntransitiveActivity) error {
+			for _, act := range linksOf(a.Actor) {
+				if !slices.Contains(k.Actors, act) {
+					k.Actors = append(k.Actors, act)
+				}
+			}
+			return nil
+		})
+	}
+	if vocab.ActivityTypes.Match(typ) {
+		_ = vocab.OnActivity(it, func(a *vocab.Activity) error {
+			k.Objects = linksOf(a.Object)
+			return nil
+		})
+	}
+	return k
+}
+
+func publishedKey(t time.Time, iri vocab.IRI) []byte {
+	k := make([]byte, 8, 8+len(iri))
+	binary.BigEndian.PutUint64(k, uint64(t.UTC().UnixNano()))
+	return append(k, iri...)
+}
+
+func addToIndex(ib *bolt.Bucket, name string, value string, iri vocab.IRI) error {
+	if value == "" {
+		return nil
+	}
+	nb, err := ib.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return errors.Annotatef(err, "could not create %s index", name)
+	}
+	vb, err := nb.CreateBucketIfNotExists([]byte(value))
+	if err != nil {
+		return errors.Annotatef(err, "could not create %s index for %s", name, value)
+	}
+	if vb.Get([]byte(iri)) != nil {
+		return nil
+	}
+	if err = vb.Put([]byte(iri), indexMark); err != nil {
+		return errors.Annotatef(err, "could not add %s to %s index", iri, name)
+	}
+	return vb.SetSequence(vb.Sequence() + 1)
+}
+
+func removeFromIndex(ib *bolt.Bucket, name string, value string, iri vocab.IRI) error {
+	nb := ib.Bucket([]byte(name))
+	if nb == nil || value == "" {
+		return nil
+	}
+	vb := nb.Bucket([]byte(value))
+	if vb == nil || vb.Get([]byte(iri)) == nil {
+		return nil
+	}
+	if err := vb.Delete([]byte(iri)); err != nil {
+		return errors.Annotatef(err, "could not remove %s from %s index", iri, name)
+	}
+	if vb.Sequence() <= 1 {
+		return nb.DeleteBucket([]byte(value))
+	}
+	return vb.SetSequence(vb.Sequence() - 1)
+}
+
+func indexBucketFromRoot(root *bolt.Bucket) (*bolt.Bucket, error) {
+	ib, err := root.CreateBucketIfNotExists([]byte(indexBucket))
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not create index bucket")
+	}
+	return ib, nil
+}
+
+// isIndexed returns true if the item identified by iri has been indexed.
+func isIndexed(root *bolt.Bucket, iri vocab.IRI) bool {
+	ib := root.Bucket([]byte(indexBucket))
+	if ib == nil {
+		return false
+	}
+	db := ib.Bucket([]byte(indexDocs))
+	return db != nil && db.Get([]byte(iri)) != nil
+}
+
+// indexItem (re)indexes the item, replacing the values it was previously indexed with.
+func indexItem(root *bolt.Bucket, it vocab.Item) error {
+	if vocab.IsNil(it) || vocab.IsIRI(it) || vocab.IsCollection(it) {
+		return nil
+	}
+	iri := it.GetLink()
+	if iri == "" {
+		return nil
+	}
+	if err := unindexItem(root, iri); err != nil {
+		return err
+	}
+	ib, err := indexBucketFromRoot(root)
+	if err != nil {
+		return err
+	}
+	k := itemIndexKeys(it)
+	for _, typ := range k.Types {
+		if err = addToIndex(ib, indexType, typ, iri); err != nil {
+			return err
+		}
+	}
+	for _, act := range k.Actors {
+		if err = addToIndex(ib, indexActor, string(act), iri); err != nil {
+			return err
+		}
+	}
+	for _, ob := range k.Objects {
+		if err = addToIndex(ib, indexObject, string(ob), iri); err != nil {
+			return err
+		}
+	}
+	if !k.Published.IsZero() {
+		pb, err := ib.CreateBucketIfNotExists([]byte(indexPublished))
+		if err != nil {
+			return errors.Annotatef(err, "could not create %s index", indexPublished)
+		}
+		if err = pb.Put(publishedKey(k.Published, iri), []byte(iri)); err != nil {
+			return errors.Annotatef(err, "could not add %s to %s index", iri, indexPublished)
+		}
+	}
+	raw, err := encodeFn(k)
+	if err != nil {
+		return errors.Annotatef(err, "could not marshal index keys for %s", iri)
+	}
+	db, err := ib.CreateBucketIfNotExists([]byte(indexDocs))
+	if err != nil {
+		return errors.Annotatef(err, "could not create index documents bucket")
+	}
+	return db.Put([]byte(iri), raw)
+}
+
+// unindexItem removes the item identified by iri from all the indexes.
+func unindexItem(root *bolt.Bucket, iri vocab.IRI) error {
+	ib := root.Bucket([]byte(indexBucket))
+	if ib == nil {
+		return nil
+	}
+	db := ib.Bucket([]byte(indexDocs))
+	if db == nil {
+		return nil
+	}
+	raw := db.Get([]byte(iri))
+	if raw == nil {
+		return nil
+	}
+	k := indexKeys{}
+	if err := decodeFn(raw, &k); err != nil {
+		return errors.Annotatef(err, "could not unmarshal index keys for %s", iri)
+	}
+	for _, typ := range k.Types {
+		if err := removeFromIndex(ib, indexType, typ, iri); err != nil {
+			return err
+		}
+	}
+	for _, act := range k.Actors {
+		if err := removeFromIndex(ib, indexActor, string(act), iri); err != nil {
+			return err
+		}
+	}
+	for _, ob := range k.Objects {
+		if err := removeFromIndex(ib, indexObject, string(ob), iri); err != nil {
+			return err
+		}
+	}
+	if pb := ib.Bucket([]byte(indexPublished)); pb != nil && !k.Published.IsZero() {
+		if err := pb.Delete(publishedKey(k.Published, iri)); err != nil {
+			return errors.Annotatef(err, "could not remove %s from %s index", iri, indexPublished)
+		}
+	}
+	return db.Delete([]byte(iri))
+}
+
+// unindexBucketTree removes from the indexes all the items stored in the b bucket, and its descendants.
+func (r *repo) unindexBucketTree(root, b *bolt.Bucket) error {
+	if b == nil {
+		return nil
+	}
+	if it, err := r.loadRawItemFromBucket(b); err == nil {
+		if err = unindexItem(root, it.GetLink()); err != nil {
+			return err
+		}
+		// NOTE: the members of a deleted collection are no longer contained in it
+		for _, m := range collectionMembers(b) {
+			if err = removeMembership(root, it.GetLink(), m.GetLink()); err != nil {
+				return err
+			}
+		}
+	}
+	return b.ForEachBucket(func(k []byte) error {
+		if isReservedKey(k) {
+			return nil
+		}
+		return r.unindexBucketTree(root, b.Bucket(k))
+	})
+}
+
+// PublishedBetween returns a check matching items published in the [from, to) interval, which can be resolved using
+// the published index. A zero value for any of the two ends means the interval is open at that end.
+func PublishedBetween(from, to time.Time) filters.Check {
+	return publishedCheck{from: from, to: to}
+}
+
+type publishedCheck struct {
+	from, to time.Time
+}
+
+func (c publishedCheck) Match(it vocab.Item) bool {
+	pub := itemIndexKeys(it).Published
+	if pub.IsZero() {
+		return false
+	}
+	if !c.from.IsZero() && pub.Before(c.from) {
+		return false
+	}
+	if !c.to.IsZero() && !pub.Before(c.to) {
+		return false
+	}
+	return true
+}
+
+// indexValuesFromCheck recognizes, by their serialization, the checks which can be resolved using an index:
+// filters.HasType, and filters.Actor or filters.Object wrapping filters.SameID checks.
+// It returns the name of the index, and the values to look up in it.
+func indexValuesFromCheck(c filters.Check) (string, []string) {
+	vals := filters.ToValues(c)
+	if len(vals) != 1 {
+		return "", nil
+	}
+	for key, values := range vals {
+		index := ""
+		switch key {
+		case indexType:
+			index = indexType
+		case indexActor + ".iri", indexActor + ".id":
+			index = indexActor
+		case indexObject + ".iri", indexObject + ".id":
+			index = indexObject
+		}
+		if index == "" {
+			return "", nil
+		}
+		for _, v := range values {
+			if v == "" || strings.ContainsAny(v[:1], "!-~") {
+				return "", nil
+			}
+		}
+		return index, values
+	}
+	return "", nil
+}
+
+// queryPlan holds the index lookup chosen for a list of checks, and the estimated number of items it returns.
+type queryPlan struct {
+	index     string
+	values    []string
+	published *publishedCheck
+	estimate  uint64
+}
+
+// planQuery picks the most selective index that can be used to resolve the checks on the collection stored in
+// bucket b.
+// It returns nil if none of the checks can be resolved using an index, if the chosen index returns more items than
+// the collection holds, so scanning the collection is cheaper, or if the indexes are not complete, because the
+// storage has not been migrated yet.
+func planQuery(root, b *bolt.Bucket, ff ...filters.Check) *queryPlan {
+	if schemaVersion(root) < indexedSchemaVersion {
+		return nil
+	}
+	ib := root.Bucket([]byte(indexBucket))
+	if ib == nil {
+		return nil
+	}
+	var best *queryPlan
+	consider := func(index string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		nb := ib.Bucket([]byte(index))
+		estimate := uint64(0)
+		for _, v := range values {
+			if nb == nil {
+				break
+			}
+			if vb := nb.Bucket([]byte(v)); vb != nil {
+				estimate += vb.Sequence()
+			}
+		}
+		if best == nil || estimate < best.estimate {
+			best = &queryPlan{index: index, values: values, estimate: estimate}
+		}
+	}
+	var ranges []publishedCheck
+	for _, f := range ff {
+		if c, ok := f.(publishedCheck); ok {
+			ranges = append(ranges, c)
+			continue
+		}
+		consider(indexValuesFromCheck(f))
+	}
+	if best == nil && len(ranges) == 0 {
+		return nil
+	}
+	// NOTE: the cost of scanning the collection is its number of items, which we need to count only up to the
+	// best estimate we already have
+	limit := uint64(0)
+	if best != nil {
+		limit = best.estimate + 1
+	}
+	size := collectionSize(b, limit)
+	if best != nil && best.estimate >= size {
+		best = nil
+	}
+	for _, rng := range ranges {
+		limit = size
+		if best != nil {
+			limit = best.estimate
+		}
+		// NOTE: we count the items in the interval only up to the best estimate we already have
+		estimate := uint64(0)
+		_ = walkPublishedIndex(ib, rng, func(_ vocab.IRI) bool {
+			estimate++
+			return estimate < limit
+		})
+		if estimate < limit {
+			p := rng
+			best = &queryPlan{index: indexPublished, published: &p, estimate: estimate}
+		}
+	}
+	return best
+}
+
+// collectionSize returns the number of items of the collection stored in bucket b: its members, and the items
+// stored as its child buckets. It stops counting at limit, if it's not zero.
+func collectionSize(b *bolt.Bucket, limit uint64) uint64 {
+	if b == nil {
+		return 0
+	}
+	size := uint64(0)
+	full := func() bool {
+		return limit > 0 && size >= limit
+	}
+	if mb := b.Bucket([]byte(membersBucket)); mb != nil {
+		c := mb.Cursor()
+		for k, _ := c.First(); k != nil && !full(); k, _ = c.Next() {
+			size++
+		}
+	}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil && !full(); k, v = c.Next() {
+		if v == nil && !isReservedKey(k) {
+			size++
+		}
+	}
+	return size
+}
+
+func walkPublishedIndex(ib *bolt.Bucket, rng publishedCheck, fn func(vocab.IRI) bool) error {
+	pb := ib.Bucket([]byte(indexPublished))
+	if pb == nil {
+		return nil
+	}
+	c := pb.Cursor()
+	k, v := c.First()
+	if !rng.from.IsZero() {
+		k, v = c.Seek(publishedKey(rng.from, ""))
+	}
+	var end []byte
+	if !rng.to.IsZero() {
+		end = publishedKey(rng.to, "")
+	}
+	for ; k != nil; k, v = c.Next() {
+		if end != nil && bytes.Compare(k, end) >= 0 {
+			break
+		}
+		if !fn(vocab.IRI(v)) {
+			break
+		}
+	}
+	return nil
+}
+
+// candidates returns the IRIs of the items the plan's index lookup resolves to.
+func (p *queryPlan) candidates(root *bolt.Bucket) []vocab.IRI {
+	iris := make([]vocab.IRI, 0, p.estimate)
+	ib := root.Bucket([]byte(indexBucket))
+	if ib == nil {
+		return iris
+	}
+	if p.published != nil {
+		_ = walkPublishedIndex(ib, *p.published, func(iri vocab.IRI) bool {
+			iris = append(iris, iri)
+			return true
+		})
+		return iris
+	}
+	nb := ib.Bucket([]byte(p.index))
+	if nb == nil {
+		return iris
+	}
+	seen := make(map[vocab.IRI]struct{}, p.estimate)
+	for _, v := range p.values {
+		vb := nb.Bucket([]byte(v))
+		if vb == nil {
+			continue
+		}
+		_ = vb.ForEach(func(k, _ []byte) error {
+			iri := vocab.IRI(k)
+			if _, ok := seen[iri]; !ok {
+				seen[iri] = struct{}{}
+				iris = append(iris, iri)
+			}
+			return nil
+		})
+	}
+	return iris
+}
+
+type indexEntry struct {
+	key []byte
+	iri vocab.IRI
+}
+
+// collectionEntries returns the plan's candidates which belong to the collection stored in bucket b, sorted in
+// the collection's storage order: first the items stored as child buckets, then the members in insertion order.
+func (p *queryPlan) collectionEntries(root, b *bolt.Bucket, colIRI vocab.IRI) []indexEntry {
+	colPath := append(itemBucketPath(colIRI), pathSeparator...)
+	entries := make([]indexEntry, 0)
+	for _, iri := range p.candidates(root) {
+		if key := memberKey(b, iri); key != nil {
+			entries = append(entries, indexEntry{key: append([]byte{1}, key...), iri: iri})
+			continue
+		}
+		childKey, isChild := bytes.CutPrefix(itemBucketPath(iri), colPath)
+		if isChild && len(childKey) > 0 && !bytes.Contains(childKey, pathSeparator) && b.Bucket(childKey) != nil {
+			entries = append(entries, indexEntry{key: append([]byte{0}, childKey...), iri: iri})
+		}
+	}
+	slices.SortFunc(entries, func(a, b indexEntry) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	return entries
+}
+
+// walkIndexEntries returns a walk function over the items of the index entries, in order.
+func (r *repo) walkIndexEntries(ctx context.Context, tx *bolt.Tx, rb *bolt.Bucket, entries []indexEntry, ff ...filters.Check) func(func(vocab.Item) bool) error {
+	matcherFn := filters.RawMatcher(ff)
+	return func(fn func(vocab.Item) bool) error {
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			it, err := r.loadItemElementTx(ctx, tx, rb, e.iri, matcherFn, ff...)
+			if err != nil || vocab.IsNil(it) {
+				continue
+			}
+			if !fn(it) {
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+// loadIndexedCollection loads the collection stored in bucket b, using an index lookup to find its items.
+// It returns false if the indexes are not more selective than scanning the collection.
+func (r *repo) loadIndexedCollection(ctx context.Context, tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, ff ...filters.Check) (vocab.Item, bool, error) {
+	rb := tx.Bucket(r.root)
+	if rb == nil {
+		return nil, false, ErrorInvalidRoot(r.root)
+	}
+	plan := planQuery(rb, b, ff...)
+	if plan == nil {
+		return nil, false, nil
+	}
+	col, err := r.loadRawItemFromBucket(b)
+	if err != nil {
+		return nil, false, err
+	}
+	entries := plan.collectionEntries(rb, b, iri)
+	items := make(vocab.ItemCollection, 0, len(entries))
+	err = r.walkIndexEntries(ctx, tx, rb, entries, ff...)(func(it vocab.Item) bool {
+		items = append(items, it)
+		return true
+	})
+	if err != nil {
+		return nil, true, err
+	}
+	if orderedCollectionTypes.Match(col.GetType()) {
+		err = vocab.OnOrderedCollection(col, buildOrderedCollection(items))
+	} else {
+		err = vocab.OnCollection(col, buildCollection(items))
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return col, true, vocab.OnObject(col, func(ob *vocab.Object) error {
+		ob.ID = iri
+		return nil
+	})
+}
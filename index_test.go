@@ -0,0 +1,279 @@
+package boltdb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	indexedNote = &vocab.Object{
+		ID:           "https://example.com/objects/1",
+		Type:         vocab.NoteType,
+		AttributedTo: vocab.IRI("https://example.com/~jdoe"),
+		Published:    publishedTime,
+	}
+	indexedCreate = &vocab.Activity{
+		ID:        "https://example.com/activities/1",
+		Type:      vocab.CreateType,
+		Actor:     vocab.IRI("https://example.com/~jdoe"),
+		Object:    vocab.IRI("https://example.com/objects/1"),
+		Published: publishedTime.Add(time.Hour),
+	}
+	indexedUpdate = &vocab.Activity{
+		ID:        "https://example.com/activities/2",
+		Type:      vocab.UpdateType,
+		Actor:     vocab.IRI("https://example.com/~alice"),
+		Object:    vocab.IRI("https://example.com/objects/1"),
+		Published: publishedTime.Add(2 * time.Hour),
+	}
+)
+
+func Test_itemIndexKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		it   vocab.Item
+		want indexKeys
+	}{
+		{
+			name: "empty",
+			want: indexKeys{},
+		},
+		{
+			name: "iri",
+			it:   vocab.IRI("https://example.com"),
+			want: indexKeys{},
+		},
+		{
+			name: "note",
+			it:   indexedNote,
+			want: indexKeys{Types: []string{"Note"}, Actors: []vocab.IRI{"https://example.com/~jdoe"}, Published: publishedTime},
+		},
+		{
+			name: "create",
+			it:   indexedCreate,
+			want: indexKeys{
+				Types:     []string{"Create"},
+				Actors:    []vocab.IRI{"https://example.com/~jdoe"},
+				Objects:   []vocab.IRI{"https://example.com/objects/1"},
+				Published: publishedTime.Add(time.Hour),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemIndexKeys(tt.it); !cmp.Equal(got, tt.want) {
+				t.Errorf("itemIndexKeys() = %s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func indexedIRIs(root *bolt.Bucket, index, value string) []vocab.IRI {
+	iris := make([]vocab.IRI, 0)
+	ib := root.Bucket([]byte(indexBucket))
+	if ib == nil || ib.Bucket([]byte(index)) == nil {
+		return iris
+	}
+	vb := ib.Bucket([]byte(index)).Bucket([]byte(value))
+	if vb == nil {
+		return iris
+	}
+	_ = vb.ForEach(func(k, _ []byte) error {
+		iris = append(iris, vocab.IRI(k))
+		return nil
+	})
+	return iris
+}
+
+func Test_indexItem(t *testing.T) {
+	db := openTestDB(t)
+	err := db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(rootBucket))
+		if err != nil {
+			return err
+		}
+		for _, it := range []vocab.Item{indexedNote, indexedCreate, indexedUpdate} {
+			if err = indexItem(root, it); err != nil {
+				t.Errorf("indexItem() error = %s", err)
+			}
+		}
+		if got := indexedIRIs(root, indexObject, "https://example.com/objects/1"); len(got) != 2 {
+			t.Errorf("object index has %d items, want 2", len(got))
+		}
+		if got := indexedIRIs(root, indexActor, "https://example.com/~jdoe"); len(got) != 2 {
+			t.Errorf("actor index has %d items, want 2", len(got))
+		}
+
+		// NOTE: re-indexing an updated item replaces its previous values
+		changed := *indexedUpdate
+		changed.Type = vocab.DeleteType
+		if err = indexItem(root, &changed); err != nil {
+			t.Errorf("indexItem() error = %s", err)
+		}
+		if got := indexedIRIs(root, indexType, string(vocab.UpdateType)); len(got) != 0 {
+			t.Errorf("type index for %s still has %d items, want 0", vocab.UpdateType, len(got))
+		}
+		if got := indexedIRIs(root, indexType, string(vocab.DeleteType)); len(got) != 1 {
+			t.Errorf("type index for %s has %d items, want 1", vocab.DeleteType, len(got))
+		}
+
+		if err = unindexItem(root, indexedCreate.ID); err != nil {
+			t.Errorf("unindexItem() error = %s", err)
+		}
+		if isIndexed(root, indexedCreate.ID) {
+			t.Errorf("isIndexed() is true for an unindexed item")
+		}
+		if got := indexedIRIs(root, indexType, string(vocab.CreateType)); len(got) != 0 {
+			t.Errorf("type index for %s still has %d items, want 0", vocab.CreateType, len(got))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("unable to update db: %s", err)
+	}
+}
+
+func Test_planQuery(t *testing.T) {
+	db := openTestDB(t)
+	_ = db.Update(func(tx *bolt.Tx) error {
+		root, _ := createRootBucket(tx, []byte(rootBucket))
+		for _, it := range []vocab.Item{indexedNote, indexedCreate, indexedUpdate} {
+			_ = indexItem(root, it)
+		}
+		collection := func(name string, size int) *bolt.Bucket {
+			b, _ := root.CreateBucketIfNotExists([]byte(name))
+			for i := 0; i < size; i++ {
+				_, _ = appendToCollectionBucket(b, vocab.IRI(fmt.Sprintf("https://example.com/%s/%d", name, i)))
+			}
+			return b
+		}
+		large := collection("large", 10)
+		small := collection("small", 1)
+		t.Run("not migrated", func(t *testing.T) {
+			legacy, _ := tx.CreateBucketIfNotExists([]byte("legacy"))
+			_ = indexItem(legacy, indexedCreate)
+			if plan := planQuery(legacy, large, filters.HasType(vocab.CreateType)); plan != nil {
+				t.Errorf("planQuery() = %+v, expected no plan before the indexes migration", plan)
+			}
+		})
+		tests := []struct {
+			name      string
+			col       *bolt.Bucket
+			ff        filters.Checks
+			wantIndex string
+			want      []vocab.IRI
+		}{
+			{
+				name: "no indexable checks",
+				col:  large,
+				ff:   filters.Checks{filters.NameIs("test")},
+			},
+			{
+				name: "small collection, broad type filter",
+				col:  small,
+				ff:   filters.Checks{filters.HasType(vocab.CreateType, vocab.UpdateType)},
+			},
+			{
+				name: "small collection, open published interval",
+				col:  small,
+				ff:   filters.Checks{PublishedBetween(publishedTime.Add(-time.Hour), time.Time{})},
+			},
+			{
+				name:      "by object",
+				col:       large,
+				ff:        filters.Checks{filters.Object(filters.SameID("https://example.com/objects/1"))},
+				wantIndex: indexObject,
+				want:      []vocab.IRI{"https://example.com/activities/1", "https://example.com/activities/2"},
+			},
+			{
+				name:      "by type is more selective than by object",
+				col:       large,
+				ff:        filters.Checks{filters.Object(filters.SameID("https://example.com/objects/1")), filters.HasType(vocab.UpdateType)},
+				wantIndex: indexType,
+				want:      []vocab.IRI{"https://example.com/activities/2"},
+			},
+			{
+				name:      "published interval",
+				col:       large,
+				ff:        filters.Checks{filters.Actor(filters.SameID("https://example.com/~jdoe")), PublishedBetween(publishedTime.Add(90*time.Minute), time.Time{})},
+				wantIndex: indexPublished,
+				want:      []vocab.IRI{"https://example.com/activities/2"},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				plan := planQuery(root, tt.col, tt.ff...)
+				if tt.wantIndex == "" {
+					if plan != nil {
+						t.Errorf("planQuery() = %+v, expected no plan", plan)
+					}
+					return
+				}
+				if plan == nil {
+					t.Fatalf("planQuery() = nil, expected a plan using the %s index", tt.wantIndex)
+				}
+				if plan.index != tt.wantIndex {
+					t.Errorf("planQuery() picked index %s, want %s", plan.index, tt.wantIndex)
+				}
+				if got := plan.candidates(root); !cmp.Equal(got, tt.want) {
+					t.Errorf("candidates() = %s", cmp.Diff(tt.want, got))
+				}
+			})
+		}
+		return nil
+	})
+}
+
+func Test_repo_Load_Indexed(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withGeneratedMocks)
+	t.Cleanup(r.Close)
+
+	tests := []struct {
+		name string
+		fil  filters.Checks
+	}{
+		{
+			name: "by type",
+			fil:  filters.Checks{filters.HasType(vocab.CreateType)},
+		},
+		{
+			name: "by actor and type",
+			fil:  filters.Checks{filters.Actor(filters.SameID(rootIRI)), filters.HasType(vocab.CreateType)},
+		},
+		{
+			name: "by published interval",
+			fil:  filters.Checks{PublishedBetween(publishedTime, publishedTime.Add(time.Second))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := make(vocab.IRIs, 0)
+			for _, it := range *allActivities.Load() {
+				if matchesAll(tt.fil, it) {
+					want = append(want, it.GetLink())
+				}
+			}
+
+			got, err := r.Load(rootOutboxIRI, tt.fil...)
+			if err != nil {
+				t.Fatalf("Load() error = %s", err)
+			}
+			gotIRIs := make(vocab.IRIs, 0)
+			_ = vocab.OnCollectionIntf(got, func(col vocab.CollectionInterface) error {
+				for _, it := range col.Collection() {
+					gotIRIs = append(gotIRIs, it.GetLink())
+				}
+				return nil
+			})
+			if !cmp.Equal(gotIRIs, want) {
+				t.Errorf("Load() items = %s", cmp.Diff(want, gotIRIs))
+			}
+		})
+	}
+}
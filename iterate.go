@@ -0,0 +1,101 @@
+package boltdb
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Iterate returns the items of the colIRI collection matching the ff checks, in storage order.
+// The items are loaded lazily, from a read transaction which stays open until the loop finishes, or it's
+// broken out of. The After and WithMaxCount checks skip to the item after the cursor, and limit the number
+// of items returned, and the Before check stops the iteration at its cursor.
+// If an error occurs, it's returned as the last value of the sequence, with a nil item.
+// The loop body must not call the methods writing to the same repository: a write which needs to grow the
+// database file waits for the open read transaction to finish, so it would never return.
+func (r *repo) Iterate(colIRI vocab.IRI, ff ...filters.Check) iter.Seq2[vocab.Item, error] {
+	return r.IterateCtx(context.Background(), colIRI, ff...)
+}
+
+// IterateCtx is Iterate, which stops, returning ctx.Err(), when ctx is done.
+func (r *repo) IterateCtx(ctx context.Context, colIRI vocab.IRI, ff ...filters.Check) iter.Seq2[vocab.Item, error] {
+	return func(yield func(vocab.Item, error) bool) {
+		start := time.Now()
+		count := 0
+		err := r.iterate(ctx, colIRI, func(it vocab.Item) bool {
+			count++
+			return yield(it, nil)
+		}, ff...)
+		r.observe(ctx, "Iterate", colIRI, start, func() (int, error) { return count, err })
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// iterate calls fn for the items of the colIRI collection, until fn returns false.
+// NOTE: the transaction is rolled back by the deferred call, even when fn breaks out of the loop,
+// or the loop body panics.
+func (r *repo) iterate(ctx context.Context, colIRI vocab.IRI, fn func(vocab.Item) bool, ff ...filters.Check) error {
+	if r == nil || r.d == nil {
+		return errNotOpen
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tx, err := r.d.Begin(false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	b, _, err := r.collectionBucket(tx, colIRI)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: unlike a page, the iteration isn't limited to filters.MaxItems items if no WithMaxCount check exists
+	cur, rest := cursorFromChecks(ff...)
+	count := 0
+	_, err = r.walkCollection(ctx, tx, b, cur.after, func(it vocab.Item) bool {
+		if cur.before != "" && it.GetLink() == cur.before {
+			return false
+		}
+		if !matchesAll(rest, it) {
+			return true
+		}
+		if cur.maxItems > 0 && count == cur.maxItems {
+			return false
+		}
+		count++
+		return fn(it)
+	}, rest...)
+	return err
+}
+
+// collectionBucket returns the bucket storing the colIRI collection, and the collection.
+func (r *repo) collectionBucket(tx *bolt.Tx, colIRI vocab.IRI) (*bolt.Bucket, vocab.Item, error) {
+	rb := tx.Bucket(r.root)
+	if rb == nil {
+		return nil, nil, ErrorInvalidRoot(r.root)
+	}
+	b, remainder, err := descendInBucket(rb, itemBucketPath(colIRI), false)
+	if err != nil || len(remainder) > 0 {
+		return nil, nil, errors.NotFoundf("%s not found", colIRI)
+	}
+	col, err := r.loadRawItemFromBucket(b)
+	if err != nil {
+		return nil, nil, errors.NewNotFound(err, "%s not found", colIRI)
+	}
+	if !vocab.IsCollection(col) {
+		return nil, nil, errors.Newf("%s is not a collection", colIRI)
+	}
+	return b, col, nil
+}
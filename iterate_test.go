@@ -0,0 +1,156 @@
+package boltdb
+
+import (
+	"context"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_repo_Iterate(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	notes := mockNotes(10)
+	iris := func(items vocab.ItemCollection) vocab.IRIs {
+		res := make(vocab.IRIs, 0, len(items))
+		for _, it := range items {
+			res = append(res, it.GetLink())
+		}
+		return res
+	}
+
+	tests := []struct {
+		name    string
+		colIRI  vocab.IRI
+		ff      []filters.Check
+		want    vocab.IRIs
+		wantErr error
+	}{
+		{
+			name:   "all items",
+			colIRI: colIRI,
+			want:   iris(notes),
+		},
+		{
+			name:   "max count",
+			colIRI: colIRI,
+			ff:     []filters.Check{filters.WithMaxCount(4)},
+			want:   iris(notes[:4]),
+		},
+		{
+			name:   "after",
+			colIRI: colIRI,
+			ff:     []filters.Check{filters.After(filters.SameID(notes[2].GetLink()))},
+			want:   iris(notes[3:]),
+		},
+		{
+			name:   "after, with max count",
+			colIRI: colIRI,
+			ff:     []filters.Check{filters.After(filters.SameID(notes[2].GetLink())), filters.WithMaxCount(2)},
+			want:   iris(notes[3:5]),
+		},
+		{
+			name:    "missing collection",
+			colIRI:  "https://example.com/missing",
+			want:    vocab.IRIs{},
+			wantErr: errors.NotFoundf("https://example.com/missing not found"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withNotesInCollection(colIRI, len(notes)))
+			t.Cleanup(r.Close)
+
+			got := make(vocab.IRIs, 0)
+			var err error
+			for it, itErr := range r.Iterate(tt.colIRI, tt.ff...) {
+				if itErr != nil {
+					err = itErr
+					continue
+				}
+				got = append(got, it.GetLink())
+			}
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("Iterate() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("Iterate() items %s", cmp.Diff(tt.want, got))
+			}
+			if open := r.d.Stats().OpenTxN; open != 0 {
+				t.Errorf("Iterate() left %d transactions open", open)
+			}
+		})
+	}
+}
+
+func Test_repo_Iterate_AfterWithoutMaxCount(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withNotesInCollection(colIRI, filters.MaxItems+10))
+	t.Cleanup(r.Close)
+
+	notes := mockNotes(filters.MaxItems + 10)
+	count := 0
+	for _, err := range r.Iterate(colIRI, filters.After(filters.SameID(notes[2].GetLink()))) {
+		if err != nil {
+			t.Fatalf("Iterate() error = %s", err)
+		}
+		count++
+	}
+	if want := len(notes) - 3; count != want {
+		t.Errorf("Iterate() returned %d items after the cursor, want %d", count, want)
+	}
+}
+
+func Test_repo_Iterate_Break(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withNotesInCollection(colIRI, 10))
+	t.Cleanup(r.Close)
+
+	count := 0
+	for _, err := range r.Iterate(colIRI) {
+		if err != nil {
+			t.Fatalf("Iterate() error = %s", err)
+		}
+		if count++; count == 3 {
+			if open := r.d.Stats().OpenTxN; open != 1 {
+				t.Errorf("Iterate() has %d transactions open while iterating, want 1", open)
+			}
+			break
+		}
+	}
+	if count != 3 {
+		t.Errorf("Iterate() returned %d items before the break, want 3", count)
+	}
+	if open := r.d.Stats().OpenTxN; open != 0 {
+		t.Errorf("Iterate() left %d transactions open after the break", open)
+	}
+}
+
+func Test_repo_IterateCtx(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withNotesInCollection(colIRI, 10))
+	t.Cleanup(r.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	count := 0
+	var err error
+	for _, itErr := range r.IterateCtx(ctx, colIRI) {
+		if itErr != nil {
+			err = itErr
+			continue
+		}
+		if count++; count == 2 {
+			cancel()
+		}
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("IterateCtx() error = %v, want %v", err, context.Canceled)
+	}
+	if count != 2 {
+		t.Errorf("IterateCtx() returned %d items after the cancellation, want 2", count)
+	}
+}
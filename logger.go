@@ -0,0 +1,103 @@
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// NOTE: the records of the structured logger use the same attributes everywhere:
+// op is the name of the repository method, iri the object it worked on, collection the collection
+// it added the object to or removed it from, bucket the OAuth2 bucket, and err the error which occurred.
+
+// fnHandler is a slog.Handler passing the records to the printf style LogFn and ErrFn functions
+// of the Config. The records with a level of slog.LevelError, or higher, go to ErrFn, the others to LogFn.
+// The debug records are dropped, as they weren't logged before the structured logger existed.
+type fnHandler struct {
+	logFn loggerFn
+	errFn loggerFn
+
+	// NOTE: the attributes are formatted by a text handler writing to buf, which is shared
+	// by all the handlers derived from this one using WithAttrs and WithGroup.
+	mu   *sync.Mutex
+	buf  *bytes.Buffer
+	text slog.Handler
+}
+
+func newFnHandler(logFn, errFn loggerFn) *fnHandler {
+	if logFn == nil {
+		logFn = defaultLogFn
+	}
+	if errFn == nil {
+		errFn = defaultLogFn
+	}
+	buf := new(bytes.Buffer)
+	return &fnHandler{
+		logFn: logFn,
+		errFn: errFn,
+		mu:    new(sync.Mutex),
+		buf:   buf,
+		text: slog.NewTextHandler(buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) > 0 {
+					return a
+				}
+				switch a.Key {
+				case slog.TimeKey, slog.LevelKey, slog.MessageKey:
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+	}
+}
+
+func (h *fnHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h *fnHandler) Handle(ctx context.Context, rec slog.Record) error {
+	h.mu.Lock()
+	h.buf.Reset()
+	err := h.text.Handle(ctx, rec)
+	attrs := strings.TrimSpace(h.buf.String())
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	fn := h.logFn
+	if rec.Level >= slog.LevelError {
+		fn = h.errFn
+	}
+	if attrs == "" {
+		fn("%s", rec.Message)
+	} else {
+		fn("%s %s", rec.Message, attrs)
+	}
+	return nil
+}
+
+func (h *fnHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hh := *h
+	hh.text = h.text.WithAttrs(attrs)
+	return &hh
+}
+
+func (h *fnHandler) WithGroup(name string) slog.Handler {
+	hh := *h
+	hh.text = h.text.WithGroup(name)
+	return &hh
+}
+
+// log returns the structured logger of the repository.
+// When the Config has no Logger, it passes the records to the LogFn and ErrFn functions.
+func (r *repo) log() *slog.Logger {
+	if r.logger != nil {
+		return r.logger
+	}
+	return slog.New(newFnHandler(r.logFn, r.errFn))
+}
@@ -0,0 +1,136 @@
+package boltdb
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+type logLines struct {
+	log []string
+	err []string
+}
+
+func (l *logLines) logFn(s string, p ...interface{}) {
+	l.log = append(l.log, fmt.Sprintf(s, p...))
+}
+
+func (l *logLines) errFn(s string, p ...interface{}) {
+	l.err = append(l.err, fmt.Sprintf(s, p...))
+}
+
+func Test_fnHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(*slog.Logger)
+		want logLines
+	}{
+		{
+			name: "info goes to LogFn",
+			fn: func(l *slog.Logger) {
+				l.Info("Added new", "op", "Save", "iri", "https://example.com/1")
+			},
+			want: logLines{log: []string{"Added new op=Save iri=https://example.com/1"}},
+		},
+		{
+			name: "errors go to ErrFn",
+			fn: func(l *slog.Logger) {
+				l.Error("Unable to close", "err", errors.Newf("test"))
+			},
+			want: logLines{err: []string{"Unable to close err=test"}},
+		},
+		{
+			name: "warnings go to LogFn",
+			fn: func(l *slog.Logger) {
+				l.Warn("Replacing the existing private key", "op", "SaveKey")
+			},
+			want: logLines{log: []string{"Replacing the existing private key op=SaveKey"}},
+		},
+		{
+			name: "expired codes go to ErrFn",
+			fn: func(l *slog.Logger) {
+				l.Error("Access code expired", "op", "LoadAccess")
+			},
+			want: logLines{err: []string{"Access code expired op=LoadAccess"}},
+		},
+		{
+			name: "debug is dropped",
+			fn: func(l *slog.Logger) {
+				l.Debug("Deleted", "op", "Delete")
+			},
+		},
+		{
+			name: "without attributes",
+			fn: func(l *slog.Logger) {
+				l.Info("100% done")
+			},
+			want: logLines{log: []string{"100% done"}},
+		},
+		{
+			name: "with attributes and groups",
+			fn: func(l *slog.Logger) {
+				l.With("op", "AddTo").WithGroup("item").Info("Added to collection", "iri", "https://example.com/1")
+			},
+			want: logLines{log: []string{"Added to collection op=AddTo item.iri=https://example.com/1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logLines{}
+			tt.fn(slog.New(newFnHandler(got.logFn, got.errFn)))
+			if !cmp.Equal(got, tt.want, cmp.AllowUnexported(logLines{})) {
+				t.Errorf("fnHandler lines %s", cmp.Diff(tt.want, got, cmp.AllowUnexported(logLines{})))
+			}
+		})
+	}
+}
+
+func Test_repo_Logger(t *testing.T) {
+	buf := bytes.Buffer{}
+	conf := Config{
+		Path:   t.TempDir(),
+		Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		// NOTE: the LogFn and ErrFn functions are not used when a Logger exists
+		LogFn: func(s string, p ...interface{}) { t.Errorf("unexpected LogFn call: "+s, p...) },
+		ErrFn: func(s string, p ...interface{}) { t.Errorf("unexpected ErrFn call: "+s, p...) },
+	}
+	if err := Bootstrap(conf); err != nil {
+		t.Fatalf("Bootstrap() error = %s", err)
+	}
+	r, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() error = %s", err)
+	}
+	if err = r.Open(); err != nil {
+		t.Fatalf("Open() error = %s", err)
+	}
+	t.Cleanup(r.Close)
+
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	if _, err = r.Save(note); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if err = r.Delete(note); err != nil {
+		t.Fatalf("Delete() error = %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		`level=INFO msg=Updated op=Save iri=https://example.com/objects/1`,
+		`level=DEBUG msg=Deleted op=Delete iri=https://example.com/objects/1`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Logger received %d records, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("Logger record %d = %q, want suffix %q", i, line, want[i])
+		}
+	}
+}
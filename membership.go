@@ -0,0 +1,98 @@
+package boltdb
+
+import (
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// NOTE: the membership index is the reverse of the collection __members buckets.
+// It has one bucket for every item that has been added to a collection, holding the IRIs of those collections as keys.
+// It's maintained by AddTo and RemoveFrom, and it uses the same layout as the type/actor/object indexes.
+const indexMembership = "member"
+
+func addMembership(root *bolt.Bucket, colIRI, iri vocab.IRI) error {
+	ib, err := indexBucketFromRoot(root)
+	if err != nil {
+		return err
+	}
+	return addToIndex(ib, indexMembership, string(iri), colIRI)
+}
+
+func removeMembership(root *bolt.Bucket, colIRI, iri vocab.IRI) error {
+	ib := root.Bucket([]byte(indexBucket))
+	if ib == nil {
+		return nil
+	}
+	return removeFromIndex(ib, indexMembership, string(iri), colIRI)
+}
+
+// containedIn returns the IRIs of the collections the iri has been added to.
+func containedIn(root *bolt.Bucket, iri vocab.IRI) []vocab.IRI {
+	cols := make([]vocab.IRI, 0)
+	ib := root.Bucket([]byte(indexBucket))
+	if ib == nil {
+		return cols
+	}
+	mb := ib.Bucket([]byte(indexMembership))
+	if mb == nil {
+		return cols
+	}
+	vb := mb.Bucket([]byte(iri))
+	if vb == nil {
+		return cols
+	}
+	_ = vb.ForEach(func(k, _ []byte) error {
+		cols = append(cols, vocab.IRI(k))
+		return nil
+	})
+	return cols
+}
+
+// removeFromAllCollections removes iri from every collection it has been added to.
+func (r *repo) removeFromAllCollections(root *bolt.Bucket, iri vocab.IRI) error {
+	for _, colIRI := range containedIn(root, iri) {
+		b, remainder, err := descendInBucket(root, itemBucketPath(colIRI), false)
+		if err == nil && len(remainder) == 0 {
+			removed, err := removeFromCollectionBucket(b, iri)
+			if err != nil {
+				return errors.Annotatef(err, "Unable to remove %s from %s", iri, colIRI)
+			}
+			if removed {
+				if err = r.decrementCollectionTotal(b, 1); err != nil {
+					return err
+				}
+				if err = r.logChange(root, Change{Op: OpRemoveFrom, IRI: iri, Collection: colIRI}); err != nil {
+					return err
+				}
+				r.emit(root.Tx(), Event{Op: OpRemoveFrom, IRI: iri, Collection: colIRI})
+			}
+		}
+		if err = removeMembership(root, colIRI, iri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContainedIn returns the IRIs of the collections the item identified by iri has been added to.
+func (r *repo) ContainedIn(iri vocab.IRI) ([]vocab.IRI, error) {
+	if r == nil || r.d == nil {
+		return nil, errNotOpen
+	}
+	var cols []vocab.IRI
+	err := r.d.View(func(tx *bolt.Tx) error {
+		var err error
+		cols, err = r.containedInTx(tx, iri)
+		return err
+	})
+	return cols, err
+}
+
+func (r *repo) containedInTx(tx *bolt.Tx, iri vocab.IRI) ([]vocab.IRI, error) {
+	root := tx.Bucket(r.root)
+	if root == nil {
+		return nil, ErrorInvalidRoot(r.root)
+	}
+	return containedIn(root, iri), nil
+}
@@ -0,0 +1,106 @@
+package boltdb
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_repo_ContainedIn(t *testing.T) {
+	inbox := vocab.IRI("https://example.com/~jdoe/inbox")
+	likes := vocab.IRI("https://example.com/objects/1/likes")
+	note := &vocab.Object{ID: "https://example.com/objects/2", Type: vocab.NoteType}
+
+	tests := []struct {
+		name     string
+		setupFns []initFn
+		remove   vocab.IRIs
+		want     []vocab.IRI
+		wantErr  error
+	}{
+		{
+			name:    "not open",
+			wantErr: errNotOpen,
+		},
+		{
+			name:     "not a member of any collection",
+			setupFns: []initFn{withOpenRoot, withBootstrap},
+			want:     []vocab.IRI{},
+		},
+		{
+			name:     "member of two collections",
+			setupFns: []initFn{withOpenRoot, withBootstrap, withItems(note), withMembership(note, inbox, likes)},
+			want:     []vocab.IRI{likes, inbox},
+		},
+		{
+			name:     "removed from one collection",
+			setupFns: []initFn{withOpenRoot, withBootstrap, withItems(note), withMembership(note, inbox, likes)},
+			remove:   vocab.IRIs{likes},
+			want:     []vocab.IRI{inbox},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, fields{path: t.TempDir()}, tt.setupFns...)
+			t.Cleanup(r.Close)
+
+			for _, col := range tt.remove {
+				if err := r.RemoveFrom(col, note); err != nil {
+					t.Fatalf("RemoveFrom() error = %s", err)
+				}
+			}
+			got, err := r.ContainedIn(note.ID)
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("ContainedIn() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("ContainedIn() = %s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func withMembership(it vocab.Item, cols ...vocab.IRI) initFn {
+	return func(t *testing.T, r *repo) *repo {
+		for _, col := range cols {
+			withOrderedCollection(col)(t, r)
+			if err := r.AddTo(col, it); err != nil {
+				t.Errorf("unable to add %s to collection %s: %s", it.GetLink(), col, err)
+			}
+		}
+		return r
+	}
+}
+
+func Test_repo_Delete_FromCollections(t *testing.T) {
+	inbox := vocab.IRI("https://example.com/~jdoe/inbox")
+	likes := vocab.IRI("https://example.com/objects/1/likes")
+	note := &vocab.Object{ID: "https://example.com/objects/2", Type: vocab.NoteType}
+
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withItems(note), withMembership(note, inbox, likes))
+	t.Cleanup(r.Close)
+	r.deleteFromCollections = true
+
+	if err := r.Delete(note); err != nil {
+		t.Fatalf("Delete() error = %s", err)
+	}
+	if got, _ := r.ContainedIn(note.ID); len(got) > 0 {
+		t.Errorf("ContainedIn() after Delete() = %v, expected no collections", got)
+	}
+	for _, colIRI := range []vocab.IRI{inbox, likes} {
+		col, err := r.Load(colIRI)
+		if err != nil {
+			t.Fatalf("Load() after Delete() error = %s", err)
+		}
+		_ = vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
+			if c.OrderedItems.Contains(note.ID) {
+				t.Errorf("collection %s still contains %s after Delete()", colIRI, note.ID)
+			}
+			if c.TotalItems != 0 {
+				t.Errorf("collection %s TotalItems after Delete() = %d, want 0", colIRI, c.TotalItems)
+			}
+			return nil
+		})
+	}
+}
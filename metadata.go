@@ -1,6 +1,7 @@
 package boltdb
 
 import (
+	"context"
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
@@ -9,6 +10,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"time"
 
 	vocab "github.com/go-ap/activitypub"
 	"github.com/go-ap/errors"
@@ -22,7 +24,9 @@ type Metadata struct {
 }
 
 // PasswordSet
-func (r *repo) PasswordSet(iri vocab.IRI, pw []byte) error {
+func (r *repo) PasswordSet(iri vocab.IRI, pw []byte) (err error) {
+	defer r.observe(context.Background(), "PasswordSet", iri, time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
@@ -35,34 +39,35 @@ func (r *repo) PasswordSet(iri vocab.IRI, pw []byte) error {
 	}
 
 	m := new(Metadata)
-	if err := r.LoadMetadata(iri, m); err != nil && !errors.IsNotFound(err) {
+	if err := r.loadMetadata(context.Background(), iri, m); err != nil && !errors.IsNotFound(err) {
 		return err
 	}
 
-	var err error
 	m.Pw, err = bcrypt.GenerateFromPassword(pw, -1)
 	if err != nil {
 		return errors.Annotatef(err, "could not generate password hash")
 	}
-	return r.SaveMetadata(iri, m)
+	return r.saveMetadata(context.Background(), iri, m)
 }
 
 // PasswordCheck
-func (r *repo) PasswordCheck(iri vocab.IRI, pw []byte) error {
+func (r *repo) PasswordCheck(iri vocab.IRI, pw []byte) (err error) {
+	defer r.observe(context.Background(), "PasswordCheck", iri, time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
 	path := itemBucketPath(iri)
 
 	m := Metadata{}
-	err := r.d.View(func(tx *bolt.Tx) error {
+	err = r.d.View(func(tx *bolt.Tx) error {
 		root := tx.Bucket(r.root)
 		if root == nil {
 			return ErrorInvalidRoot(r.root)
 		}
 		var b *bolt.Bucket
 		var err error
-		b, path, err = descendInBucket(root, path, false)
+		b, _, err = descendInBucket(root, path, false)
 		if err != nil {
 			return errors.Newf("unable to find %s in root bucket", path)
 		}
@@ -70,7 +75,7 @@ func (r *repo) PasswordCheck(iri vocab.IRI, pw []byte) error {
 		if len(entryBytes) == 0 {
 			return errors.NotFoundf("not found")
 		}
-		if err = decodeFn(entryBytes, &m); err != nil {
+		if err = r.decodeMetadata(entryBytes, path, &m); err != nil {
 			return errors.Annotatef(err, "could not unmarshal metadata")
 		}
 		if err := bcrypt.CompareHashAndPassword(m.Pw, pw); err != nil {
@@ -83,81 +88,129 @@ func (r *repo) PasswordCheck(iri vocab.IRI, pw []byte) error {
 
 // LoadMetadata
 func (r *repo) LoadMetadata(iri vocab.IRI, m any) error {
+	return r.LoadMetadataCtx(context.Background(), iri, m)
+}
+
+// LoadMetadataCtx is LoadMetadata, which returns ctx.Err() if ctx is done before it starts.
+func (r *repo) LoadMetadataCtx(ctx context.Context, iri vocab.IRI, m any) (err error) {
+	defer r.observe(ctx, "LoadMetadata", iri, time.Now(), func() (int, error) { return 1, err })
+	return r.loadMetadata(ctx, iri, m)
+}
+
+func (r *repo) loadMetadata(ctx context.Context, iri vocab.IRI, m any) error {
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
-	path := itemBucketPath(iri)
-
-	return r.d.View(func(tx *bolt.Tx) error {
-		root := tx.Bucket(r.root)
-		if root == nil {
-			return ErrorInvalidRoot(r.root)
-		}
-		var b *bolt.Bucket
-		var err error
-		b, path, err = descendInBucket(root, path, false)
-		if err != nil {
-			return errors.NotFoundf("Unable to find %s in root bucket", path)
-		}
-		entryBytes := b.Get([]byte(metaDataKey))
-		if len(entryBytes) == 0 {
-			return errors.NotFoundf("not found")
-		}
-		return decodeFn(entryBytes, m)
+	return r.view(ctx, func(tx *bolt.Tx) error {
+		return r.loadMetadataTx(tx, iri, m)
 	})
 }
 
+func (r *repo) loadMetadataTx(tx *bolt.Tx, iri vocab.IRI, m any) error {
+	itemPath := itemBucketPath(iri)
+	root := tx.Bucket(r.root)
+	if root == nil {
+		return ErrorInvalidRoot(r.root)
+	}
+	b, path, err := descendInBucket(root, itemPath, false)
+	if err != nil {
+		return errors.NotFoundf("Unable to find %s in root bucket", path)
+	}
+	entryBytes := b.Get([]byte(metaDataKey))
+	if len(entryBytes) == 0 {
+		return errors.NotFoundf("not found")
+	}
+	return r.decodeMetadata(entryBytes, itemPath, m)
+}
+
+// decodeMetadata decrypts, and decodes into m, the raw metadata stored in the bucket at path.
+func (r *repo) decodeMetadata(raw, path []byte, m any) error {
+	raw, err := r.unseal(raw, path)
+	if err != nil {
+		return err
+	}
+	return r.decode(raw, m)
+}
+
 // SaveMetadata
 func (r *repo) SaveMetadata(iri vocab.IRI, m any) error {
+	return r.SaveMetadataCtx(context.Background(), iri, m)
+}
+
+// SaveMetadataCtx is SaveMetadata, which doesn't commit the changes if ctx is done before they're finished.
+func (r *repo) SaveMetadataCtx(ctx context.Context, iri vocab.IRI, m any) (err error) {
+	defer r.observe(ctx, "SaveMetadata", iri, time.Now(), func() (int, error) { return 1, err })
+	return r.saveMetadata(ctx, iri, m)
+}
+
+func (r *repo) saveMetadata(ctx context.Context, iri vocab.IRI, m any) error {
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
 	if m == nil {
 		return errors.Newf("Could not save nil metadata")
 	}
+	return r.updateCtx(ctx, func(tx *bolt.Tx) error {
+		return r.saveMetadataTx(tx, iri, m)
+	})
+}
 
+func (r *repo) saveMetadataTx(tx *bolt.Tx, iri vocab.IRI, m any) error {
 	path := itemBucketPath(iri)
-	err := r.d.Update(func(tx *bolt.Tx) error {
-		root, err := tx.CreateBucketIfNotExists(r.root)
-		if err != nil {
-			return errors.Errorf("Not able to write to root bucket %s", r.root)
-		}
-		if root == nil {
-			return ErrorInvalidRoot(r.root)
-		}
-		if !root.Writable() {
-			return errors.Errorf("Non writeable bucket %s", r.root)
-		}
-		var b *bolt.Bucket
-		b, _, err = descendInBucket(root, path, true)
-		if err != nil {
-			return errors.Newf("Unable to find %s in root bucket", path)
-		}
-		if !b.Writable() {
-			return errors.Errorf("Non writeable bucket %s", path)
-		}
-
-		entryBytes, err := encodeFn(m)
-		if err != nil {
-			return errors.Annotatef(err, "Could not marshal metadata")
-		}
-		err = b.Put([]byte(metaDataKey), entryBytes)
-		if err != nil {
-			return errors.Errorf("Could not insert entry: %s", err)
-		}
-		return nil
-	})
+	root, err := createRootBucket(tx, r.root)
+	if err != nil {
+		return errors.Errorf("Not able to write to root bucket %s", r.root)
+	}
+	if root == nil {
+		return ErrorInvalidRoot(r.root)
+	}
+	if !root.Writable() {
+		return errors.Errorf("Non writeable bucket %s", r.root)
+	}
+	b, _, err := descendInBucket(root, path, true)
+	if err != nil {
+		return errors.Newf("Unable to find %s in root bucket", path)
+	}
+	if !b.Writable() {
+		return errors.Errorf("Non writeable bucket %s", path)
+	}
+	if err = r.saveMetadataInBucket(b, path, m); err != nil {
+		return err
+	}
+	if err = r.logChange(root, Change{Op: OpSaveMetadata, IRI: iri}); err != nil {
+		return err
+	}
+	r.emit(tx, Event{Op: OpSaveMetadata, IRI: iri})
+	return nil
+}
 
-	return err
+func (r *repo) saveMetadataInBucket(b *bolt.Bucket, path []byte, m any) error {
+	entryBytes, err := r.encode(m)
+	if err != nil {
+		return errors.Annotatef(err, "Could not marshal metadata")
+	}
+	if entryBytes, err = r.compress(entryBytes); err != nil {
+		return err
+	}
+	if entryBytes, err = r.seal(entryBytes, path); err != nil {
+		return errors.Annotatef(err, "Could not encrypt metadata")
+	}
+	err = b.Put([]byte(metaDataKey), entryBytes)
+	if err != nil {
+		return errors.Errorf("Could not insert entry: %s", err)
+	}
+	return nil
 }
 
 // LoadKey loads a private key for an actor found by its IRI
-func (r *repo) LoadKey(iri vocab.IRI) (crypto.PrivateKey, error) {
+func (r *repo) LoadKey(iri vocab.IRI) (_ crypto.PrivateKey, err error) {
+	defer r.observe(context.Background(), "LoadKey", iri, time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
 	m := new(Metadata)
-	if err := r.LoadMetadata(iri, m); err != nil {
+	if err := r.loadMetadata(context.Background(), iri, m); err != nil {
 		return nil, err
 	}
 	b, _ := pem.Decode(m.PrivateKey)
@@ -172,17 +225,19 @@ func (r *repo) LoadKey(iri vocab.IRI) (crypto.PrivateKey, error) {
 }
 
 // SaveKey saves a private key for an actor found by its IRI
-func (r *repo) SaveKey(iri vocab.IRI, key crypto.PrivateKey) (*vocab.PublicKey, error) {
+func (r *repo) SaveKey(iri vocab.IRI, key crypto.PrivateKey) (_ *vocab.PublicKey, err error) {
+	defer r.observe(context.Background(), "SaveKey", iri, time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
 	m := new(Metadata)
-	if err := r.LoadMetadata(iri, m); err != nil && !errors.IsNotFound(err) {
+	if err := r.loadMetadata(context.Background(), iri, m); err != nil && !errors.IsNotFound(err) {
 		return nil, err
 	}
 
 	if m.PrivateKey != nil {
-		r.logFn("actor %s already has a private key", iri)
+		r.log().Warn("Replacing the existing private key", "op", "SaveKey", "iri", iri)
 	}
 	prvEnc, err := x509.MarshalPKCS8PrivateKey(key)
 	if err != nil {
@@ -193,7 +248,7 @@ func (r *repo) SaveKey(iri vocab.IRI, key crypto.PrivateKey) (*vocab.PublicKey,
 		Type:  "PRIVATE KEY",
 		Bytes: prvEnc,
 	})
-	if err = r.SaveMetadata(iri, m); err != nil {
+	if err = r.saveMetadata(context.Background(), iri, m); err != nil {
 		return nil, err
 	}
 
@@ -208,12 +263,12 @@ func (r *repo) SaveKey(iri vocab.IRI, key crypto.PrivateKey) (*vocab.PublicKey,
 	case ed25519.PrivateKey:
 		pub = prv.Public()
 	default:
-		r.errFn("received key %T does not match any of the known private key types", key)
+		r.log().Error("Unknown private key type", "op", "SaveKey", "iri", iri, "err", errors.Errorf("received key %T does not match any of the known private key types", key))
 		return nil, nil
 	}
 	pubEnc, err := x509.MarshalPKIXPublicKey(pub)
 	if err != nil {
-		r.errFn("unable to x509.MarshalPKIXPublicKey() the private key %T for %s", pub, iri)
+		r.log().Error("Unable to marshal the public key", "op", "SaveKey", "iri", iri, "err", err)
 		return nil, err
 	}
 	pubEncoded := pem.EncodeToMemory(&pem.Block{
@@ -0,0 +1,270 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// NOTE: the version of the storage layout is kept under the __schema_version key in the root bucket.
+// Databases created before the version marker existed have no key, and are considered to be at version 0.
+// Every migration upgrades the layout from the previous version, so the current version is the number of
+// registered migrations.
+const schemaVersionKey = "__schema_version"
+
+type migration struct {
+	name string
+	fn   func(r *repo, root *bolt.Bucket, step *MigrationStep) error
+}
+
+// migrations holds, in order, the functions upgrading the storage layout to the next schema version.
+var migrations = []migration{
+	{name: "store collection members as per-item keys", fn: migrateCollectionMembers},
+	{name: "build the secondary indexes", fn: migrateIndexes},
+}
+
+var currentSchemaVersion = uint64(len(migrations))
+
+// indexedSchemaVersion is the schema version from which all the stored objects are in the secondary indexes.
+const indexedSchemaVersion = 2
+
+var ErrorSchemaVersion = func(have, want uint64) error {
+	if have > want {
+		return errors.Newf("storage schema version %d is newer than the supported version %d", have, want)
+	}
+	return errors.Newf("storage schema version %d is older than %d, it needs to be migrated", have, want)
+}
+
+// MigrationStep describes the changes done by one of the migrations.
+type MigrationStep struct {
+	Version uint64
+	Name    string
+	Changes []string
+}
+
+func (s *MigrationStep) changed(format string, args ...any) {
+	s.Changes = append(s.Changes, fmt.Sprintf(format, args...))
+}
+
+// MigrationReport describes the changes made by Migrate, or the ones that would be made in dry-run mode.
+type MigrationReport struct {
+	From   uint64
+	To     uint64
+	DryRun bool
+	Steps  []MigrationStep
+}
+
+func schemaVersion(root *bolt.Bucket) uint64 {
+	v := root.Get([]byte(schemaVersionKey))
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+func setSchemaVersion(root *bolt.Bucket, v uint64) error {
+	if err := root.Put([]byte(schemaVersionKey), itob(v)); err != nil {
+		return errors.Annotatef(err, "could not store schema version")
+	}
+	return nil
+}
+
+// createRootBucket returns the root bucket, creating it, and marking it with the current schema version,
+// if it doesn't exist.
+func createRootBucket(tx *bolt.Tx, path []byte) (*bolt.Bucket, error) {
+	if root := tx.Bucket(path); root != nil {
+		return root, nil
+	}
+	root, err := tx.CreateBucket(path)
+	if err != nil {
+		return nil, err
+	}
+	return root, setSchemaVersion(root, currentSchemaVersion)
+}
+
+// checkSchemaVersion returns an error if the layout of the storage doesn't match the current schema version.
+func checkSchemaVersion(db *bolt.DB, path []byte) error {
+	return db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(path)
+		if root == nil {
+			return nil
+		}
+		if v := schemaVersion(root); v != currentSchemaVersion {
+			return ErrorSchemaVersion(v, currentSchemaVersion)
+		}
+		return nil
+	})
+}
+
+var errDryRun = errors.Newf("dry-run")
+
+// Migrate upgrades the layout of the storage to the current schema version.
+func Migrate(conf Config) (MigrationReport, error) {
+	return migrate(conf, false)
+}
+
+// MigrateDryRun reports the changes Migrate would make to the storage, without saving them.
+func MigrateDryRun(conf Config) (MigrationReport, error) {
+	return migrate(conf, true)
+}
+
+func migrate(conf Config, dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{From: currentSchemaVersion, To: currentSchemaVersion, DryRun: dryRun}
+	if conf.Path == "" {
+		return report, os.ErrNotExist
+	}
+	if conf.ReadOnly {
+		return report, ErrorReadOnly
+	}
+	r, err := New(conf)
+	if err != nil {
+		return report, err
+	}
+	db, err := r.openDB()
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return nil
+		}
+		report.From = schemaVersion(root)
+		if report.From > currentSchemaVersion {
+			return ErrorSchemaVersion(report.From, currentSchemaVersion)
+		}
+		for v := report.From; v < currentSchemaVersion; v++ {
+			m := migrations[v]
+			step := MigrationStep{Version: v + 1, Name: m.name}
+			if err := m.fn(r, root, &step); err != nil {
+				return errors.Annotatef(err, "migration to version %d failed", v+1)
+			}
+			report.Steps = append(report.Steps, step)
+		}
+		if err := setSchemaVersion(root, currentSchemaVersion); err != nil {
+			return err
+		}
+		if dryRun {
+			// NOTE: returning an error rolls back the transaction
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return report, err
+}
+
+func isRootReservedKey(k []byte) bool {
+	switch string(k) {
+	case indexBucket, changelogBucket, clientsBucket, authorizeBucket, accessBucket, refreshBucket:
+		return true
+	}
+	return isReservedKey(k)
+}
+
+// itemBucketPaths returns the paths, relative to root, of all the buckets storing an object or a collection.
+func itemBucketPaths(root *bolt.Bucket) [][][]byte {
+	return bucketPathsWithKey(root, []byte(objectKey))
+}
+
+// bucketPathsWithKey returns the paths, relative to root, of all the item buckets containing the key.
+// The paths are collected before making any changes, as bolt doesn't allow changing a bucket while iterating it.
+func bucketPathsWithKey(root *bolt.Bucket, key []byte) [][][]byte {
+	paths := make([][][]byte, 0)
+	_ = walkItemBuckets(root, func(path [][]byte, b *bolt.Bucket) error {
+		if b.Get(key) != nil {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths
+}
+
+// walkItemBuckets calls fn, depth first, for all the buckets under root which can store objects, collections
+// or metadata, skipping the reserved buckets.
+func walkItemBuckets(root *bolt.Bucket, fn func(path [][]byte, b *bolt.Bucket) error) error {
+	var walk func(b *bolt.Bucket, path [][]byte) error
+	walk = func(b *bolt.Bucket, path [][]byte) error {
+		if len(path) > 0 {
+			if err := fn(path, b); err != nil {
+				return err
+			}
+		}
+		return b.ForEachBucket(func(k []byte) error {
+			if isReservedKey(k) || (len(path) == 0 && isRootReservedKey(k)) {
+				return nil
+			}
+			return walk(b.Bucket(k), append(path[:len(path):len(path)], bytes.Clone(k)))
+		})
+	}
+	return walk(root, nil)
+}
+
+func bucketAtPath(root *bolt.Bucket, path [][]byte) *bolt.Bucket {
+	b := root
+	for _, k := range path {
+		if b = b.Bucket(k); b == nil {
+			return nil
+		}
+	}
+	return b
+}
+
+// migrateCollectionMembers moves the items kept inline in the collection headers to per-item keys, and adds all
+// the collection members to the membership index.
+func migrateCollectionMembers(r *repo, root *bolt.Bucket, step *MigrationStep) error {
+	for _, path := range itemBucketPaths(root) {
+		b := bucketAtPath(root, path)
+		if b == nil {
+			continue
+		}
+		col, err := r.loadRawItemFromBucket(b)
+		if err != nil || !vocab.IsCollection(col) {
+			continue
+		}
+		inline := 0
+		_ = onCollectionHeader(col, func(items *vocab.ItemCollection, _ *uint) {
+			inline = len(*items)
+		})
+		if inline > 0 {
+			if err = r.saveCollectionHeader(root, b, col); err != nil {
+				return errors.Annotatef(err, "Unable to migrate collection %s", col.GetLink())
+			}
+			step.changed("moved %d inline items of %s to per-item keys", inline, col.GetLink())
+		}
+		for _, it := range collectionMembers(b) {
+			if err = addMembership(root, col.GetLink(), it.GetLink()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateIndexes adds to the secondary indexes all the objects which haven't been indexed yet.
+func migrateIndexes(r *repo, root *bolt.Bucket, step *MigrationStep) error {
+	for _, path := range itemBucketPaths(root) {
+		b := bucketAtPath(root, path)
+		if b == nil {
+			continue
+		}
+		it, err := r.loadRawItemFromBucket(b)
+		if err != nil || vocab.IsCollection(it) || isIndexed(root, it.GetLink()) {
+			continue
+		}
+		if err = indexItem(root, it); err != nil {
+			return errors.Annotatef(err, "could not index %s", it.GetLink())
+		}
+		step.changed("indexed %s", it.GetLink())
+	}
+	return nil
+}
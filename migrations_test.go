@@ -0,0 +1,127 @@
+package boltdb
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	legacyNote = &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	legacyCol  = &vocab.OrderedCollection{
+		ID:           "https://example.com/~jdoe/outbox",
+		Type:         vocab.OrderedCollectionType,
+		OrderedItems: vocab.ItemCollection{legacyNote.GetLink()},
+		TotalItems:   1,
+	}
+)
+
+// withLegacyLayout stores the items the way they were stored before the schema version existed:
+// no version marker, no indexes, and collection items kept inline in the collection header.
+func withLegacyLayout(version uint64) initFn {
+	return func(t *testing.T, r *repo) *repo {
+		err := r.d.Update(func(tx *bolt.Tx) error {
+			root, err := tx.CreateBucketIfNotExists([]byte(rootBucket))
+			if err != nil {
+				return err
+			}
+			if version > 0 {
+				if err = setSchemaVersion(root, version); err != nil {
+					return err
+				}
+			}
+			for _, it := range []vocab.Item{legacyNote, legacyCol} {
+				b, _, err := descendInBucket(root, itemBucketPath(it.GetLink()), true)
+				if err != nil {
+					return err
+				}
+				raw, err := encodeItemFn(it)
+				if err != nil {
+					return err
+				}
+				if err = b.Put([]byte(objectKey), raw); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("unable to create legacy layout: %s", err)
+		}
+		return r
+	}
+}
+
+func Test_Migrate(t *testing.T) {
+	path := t.TempDir()
+	r := mockRepo(t, fields{path: path}, withOpenRoot, withLegacyLayout(0))
+	r.Close()
+
+	if err := r.Open(); !cmp.Equal(err, ErrorSchemaVersion(0, currentSchemaVersion), EquateWeakErrors) {
+		t.Fatalf("Open() of unmigrated storage error = %v", err)
+	}
+
+	dry, err := MigrateDryRun(Config{Path: path})
+	if err != nil {
+		t.Fatalf("MigrateDryRun() error = %s", err)
+	}
+	if !dry.DryRun || dry.From != 0 || dry.To != currentSchemaVersion || len(dry.Steps) != len(migrations) {
+		t.Errorf("MigrateDryRun() report = %+v", dry)
+	}
+	if err = r.Open(); err == nil {
+		t.Errorf("Open() after MigrateDryRun() succeeded, expected the storage to not be changed")
+		r.Close()
+	}
+
+	report, err := Migrate(Config{Path: path})
+	if err != nil {
+		t.Fatalf("Migrate() error = %s", err)
+	}
+	if !cmp.Equal(report.Steps, dry.Steps) {
+		t.Errorf("Migrate() steps differ from the dry-run ones: %s", cmp.Diff(dry.Steps, report.Steps))
+	}
+	for _, step := range report.Steps {
+		if len(step.Changes) == 0 {
+			t.Errorf("Migrate() step %d %q reported no changes", step.Version, step.Name)
+		}
+	}
+
+	if err = r.Open(); err != nil {
+		t.Fatalf("Open() after Migrate() error = %s", err)
+	}
+	_ = r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(rootBucket))
+		if v := schemaVersion(root); v != currentSchemaVersion {
+			t.Errorf("schema version after Migrate() = %d, want %d", v, currentSchemaVersion)
+		}
+		if !isIndexed(root, legacyNote.GetLink()) {
+			t.Errorf("%s was not indexed by Migrate()", legacyNote.GetLink())
+		}
+		if got := containedIn(root, legacyNote.GetLink()); !cmp.Equal(got, []vocab.IRI{legacyCol.ID}) {
+			t.Errorf("containedIn() after Migrate() = %s", cmp.Diff([]vocab.IRI{legacyCol.ID}, got))
+		}
+		return nil
+	})
+	r.Close()
+
+	again, err := Migrate(Config{Path: path})
+	if err == nil && len(again.Steps) > 0 {
+		t.Errorf("Migrate() of an up to date storage ran %d steps", len(again.Steps))
+	}
+}
+
+func Test_repo_Open_NewerSchema(t *testing.T) {
+	path := t.TempDir()
+	r := mockRepo(t, fields{path: path}, withOpenRoot, withLegacyLayout(currentSchemaVersion+1))
+	r.Close()
+
+	wantErr := ErrorSchemaVersion(currentSchemaVersion+1, currentSchemaVersion)
+	if err := r.Open(); !cmp.Equal(err, wantErr, EquateWeakErrors) {
+		t.Errorf("Open() error = %s", cmp.Diff(wantErr, err, EquateWeakErrors))
+	}
+	if _, err := Migrate(Config{Path: path}); !cmp.Equal(err, wantErr, EquateWeakErrors) {
+		t.Errorf("Migrate() error = %s", cmp.Diff(wantErr, err, EquateWeakErrors))
+	}
+}
@@ -0,0 +1,116 @@
+package boltdb
+
+import (
+	"context"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Observation describes a call to one of the public operations of the repository.
+type Observation struct {
+	// Context is the context the operation received, it's context.Background() for the methods without one.
+	// It can be used for retrieving the request-scoped values, like the tracing spans.
+	Context context.Context
+	// Op is the name of the repository method, eg: "Load", "AddTo", "SaveClient".
+	Op string
+	// IRI is the object, or collection, the operation worked on. It's empty for the OAuth2 operations.
+	IRI      vocab.IRI
+	Start    time.Time
+	Duration time.Duration
+	// Count is the number of items loaded, or changed, by the operation. It's zero for failed operations.
+	Count int
+	Err   error
+}
+
+// Stats is a snapshot of the statistics of the bolt database.
+type Stats struct {
+	Time time.Time
+	// DB holds the statistics accumulated since the database was opened, including the transactions' ones in DB.TxStats.
+	DB bolt.Stats
+	// Delta holds the difference from the previous snapshot.
+	Delta bolt.Stats
+}
+
+// Observer receives the measurements of the repository, it can be used for building metrics and tracing adapters.
+// The methods are called synchronously, so they should return quickly.
+type Observer interface {
+	// Observe is called after every public operation of the repository.
+	Observe(Observation)
+	// ObserveStats is called periodically, while the repository is open, with the statistics of the database.
+	ObserveStats(Stats)
+}
+
+const defaultStatsInterval = 10 * time.Second
+
+// observe passes to the observer the measurements of the op operation, which started at the start moment.
+// It's meant to be deferred, so the result function is called after the operation has finished.
+func (r *repo) observe(ctx context.Context, op string, iri vocab.IRI, start time.Time, result func() (int, error)) {
+	if r == nil || r.observer == nil {
+		return
+	}
+	count, err := result()
+	if err != nil {
+		count = 0
+	}
+	r.observer.Observe(Observation{
+		Context:  ctx,
+		Op:       op,
+		IRI:      iri,
+		Start:    start,
+		Duration: time.Since(start),
+		Count:    count,
+		Err:      err,
+	})
+}
+
+// itemCount returns the number of items in it, when it's a collection, or 1 for all other items.
+func itemCount(it vocab.Item) int {
+	if vocab.IsNil(it) {
+		return 0
+	}
+	if col, ok := it.(vocab.CollectionInterface); ok {
+		return len(col.Collection())
+	}
+	return 1
+}
+
+func linkOf(it vocab.Item) vocab.IRI {
+	if vocab.IsNil(it) {
+		return ""
+	}
+	return it.GetLink()
+}
+
+// watchStats starts sending snapshots of the db statistics to the observer, until the returned function is called.
+func (r *repo) watchStats(db *bolt.DB) func() {
+	interval := r.statsInterval
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		prev := db.Stats()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-t.C:
+				cur := db.Stats()
+				r.observer.ObserveStats(Stats{Time: now, DB: cur, Delta: cur.Sub(&prev)})
+				prev = cur
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,180 @@
+package boltdb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type mockObserver struct {
+	mu           sync.Mutex
+	observations []Observation
+	stats        []Stats
+}
+
+func (o *mockObserver) Observe(ob Observation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.observations = append(o.observations, ob)
+}
+
+func (o *mockObserver) ObserveStats(s Stats) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stats = append(o.stats, s)
+}
+
+func (o *mockObserver) statsCount() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.stats)
+}
+
+func withObserver(o Observer) initFn {
+	return func(t *testing.T, r *repo) *repo {
+		r.observer = o
+		return r
+	}
+}
+
+func Test_repo_Observe(t *testing.T) {
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	colIRI := vocab.IRI("https://example.com/outbox")
+	missing := vocab.IRI("https://example.com/objects/missing")
+
+	o := new(mockObserver)
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withObserver(o))
+	t.Cleanup(r.Close)
+
+	_, _ = r.Save(note)
+	_ = r.AddTo(colIRI, note, note)
+	_, _ = r.Load(colIRI)
+	_, _ = r.Load(missing)
+	_ = r.SaveMetadata(note.ID, &Metadata{Pw: defaultPw})
+	_ = r.PasswordCheck(note.ID, defaultPw)
+	_ = r.RemoveFrom(colIRI, note)
+	_ = r.Delete(note)
+	_ = r.SaveClient(defaultClient)
+	_, _ = r.ListClients()
+	_, _ = r.GetClient("missing")
+
+	want := []Observation{
+		{Op: "Save", IRI: note.ID, Count: 1},
+		{Op: "AddTo", IRI: colIRI, Count: 1},
+		{Op: "Load", IRI: colIRI, Count: 1},
+		{Op: "Load", IRI: missing, Err: errors.NotFoundf("not found")},
+		{Op: "SaveMetadata", IRI: note.ID, Count: 1},
+		{Op: "PasswordCheck", IRI: note.ID, Count: 1},
+		{Op: "RemoveFrom", IRI: colIRI, Count: 1},
+		{Op: "Delete", IRI: note.ID, Count: 1},
+		{Op: "SaveClient", Count: 1},
+		{Op: "ListClients", Count: 1},
+		{Op: "GetClient", Err: errors.NotFoundf("missing not found")},
+	}
+	ignoreTimes := cmpopts.IgnoreFields(Observation{}, "Context", "Start", "Duration")
+	if !cmp.Equal(o.observations, want, ignoreTimes, EquateWeakErrors) {
+		t.Errorf("Observe() calls %s", cmp.Diff(want, o.observations, ignoreTimes, EquateWeakErrors))
+	}
+	for _, ob := range o.observations {
+		if ob.Start.IsZero() || ob.Duration < 0 {
+			t.Errorf("Observe() for %s has invalid timing: start %s, duration %s", ob.Op, ob.Start, ob.Duration)
+		}
+	}
+}
+
+type requestIDKey struct{}
+
+func Test_repo_Observe_Context(t *testing.T) {
+	o := new(mockObserver)
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withObserver(o))
+	t.Cleanup(r.Close)
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	_, _ = r.SaveCtx(ctx, note)
+	_, _ = r.LoadCtx(ctx, note.ID)
+	_ = r.DeleteCtx(ctx, note)
+	_, _ = r.Load(note.ID)
+
+	want := []any{"req-1", "req-1", "req-1", nil}
+	if len(o.observations) != len(want) {
+		t.Fatalf("Observe() has been called %d times, want %d", len(o.observations), len(want))
+	}
+	for i, ob := range o.observations {
+		if got := ob.Context.Value(requestIDKey{}); got != want[i] {
+			t.Errorf("Observe() for %s received request id %v, want %v", ob.Op, got, want[i])
+		}
+	}
+}
+
+func Test_repo_watchStats(t *testing.T) {
+	o := new(mockObserver)
+	conf := Config{Path: t.TempDir(), Observer: o, StatsInterval: 10 * time.Millisecond}
+	if err := Bootstrap(conf); err != nil {
+		t.Fatalf("Bootstrap() error = %s", err)
+	}
+	r, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() error = %s", err)
+	}
+	if err = r.Open(); err != nil {
+		t.Fatalf("Open() error = %s", err)
+	}
+	if _, err = r.Save(&vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for o.statsCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	r.Close()
+
+	count := o.statsCount()
+	if count == 0 {
+		t.Fatalf("ObserveStats() has not been called")
+	}
+	if s := o.stats[0]; s.Time.IsZero() || s.DB.TxN == 0 {
+		t.Errorf("ObserveStats() received an invalid snapshot %#v", s)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if o.statsCount() != count {
+		t.Errorf("ObserveStats() has been called after Close()")
+	}
+}
+
+func Test_itemCount(t *testing.T) {
+	tests := []struct {
+		name string
+		it   vocab.Item
+		want int
+	}{
+		{
+			name: "nil",
+			want: 0,
+		},
+		{
+			name: "object",
+			it:   &vocab.Object{ID: "https://example.com/1"},
+			want: 1,
+		},
+		{
+			name: "collection",
+			it:   &vocab.OrderedCollection{ID: "https://example.com/outbox", OrderedItems: vocab.ItemCollection{vocab.IRI("https://example.com/1"), vocab.IRI("https://example.com/2")}},
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemCount(tt.it); got != tt.want {
+				t.Errorf("itemCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
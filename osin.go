@@ -2,6 +2,7 @@ package boltdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"time"
 
@@ -75,16 +76,18 @@ func (r *repo) Clone() osin.Storage {
 // Close closes the boltdb database if possible.
 func (r *repo) Close() {
 	if err := r.close(); err != nil {
-		r.errFn("error closing: %+s", err)
+		r.log().Error("Unable to close", "err", err)
 	}
 }
 
-func (r *repo) ListClients() ([]osin.Client, error) {
+func (r *repo) ListClients() (clients []osin.Client, err error) {
+	defer r.observe(context.Background(), "ListClients", "", time.Now(), func() (int, error) { return len(clients), err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
-	clients := make([]osin.Client, 0)
-	err := r.d.View(func(tx *bolt.Tx) error {
+	clients = make([]osin.Client, 0)
+	err = r.d.View(func(tx *bolt.Tx) error {
 		rb := tx.Bucket(r.root)
 		if rb == nil {
 			return errors.Errorf("Invalid bucket %s", r.root)
@@ -96,8 +99,8 @@ func (r *repo) ListClients() ([]osin.Client, error) {
 		}
 		c := cb.Cursor()
 		for k, raw := c.First(); k != nil; k, raw = c.Next() {
-			if err := decodeFn(raw, &cl); err != nil {
-				r.errFn("Unable to unmarshal client object %s", err)
+			if err := r.decode(raw, &cl); err != nil {
+				r.log().Error("Unable to unmarshal client object", "op", "ListClients", "bucket", clientsBucket, "err", err)
 				continue
 			}
 			d := osin.DefaultClient{
@@ -114,7 +117,9 @@ func (r *repo) ListClients() ([]osin.Client, error) {
 }
 
 // GetClient loads the client by id
-func (r *repo) GetClient(id string) (osin.Client, error) {
+func (r *repo) GetClient(id string) (_ osin.Client, err error) {
+	defer r.observe(context.Background(), "GetClient", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
@@ -123,7 +128,7 @@ func (r *repo) GetClient(id string) (osin.Client, error) {
 	}
 	c := osin.DefaultClient{}
 
-	err := r.d.View(r.loadClientFromTx(id, &c))
+	err = r.d.View(r.loadClientFromTx(id, &c))
 	if err != nil {
 		return nil, err
 	}
@@ -146,7 +151,7 @@ func (r *repo) loadClientFromTx(id string, c *osin.DefaultClient) func(*bolt.Tx)
 		if len(raw) == 0 {
 			return errors.NotFoundf("%s not found", id)
 		}
-		if err := decodeFn(raw, &cl); err != nil {
+		if err := r.decode(raw, &cl); err != nil {
 			return errors.Annotatef(err, "Unable to unmarshal client object")
 		}
 		c.Id = cl.Id
@@ -158,7 +163,9 @@ func (r *repo) loadClientFromTx(id string, c *osin.DefaultClient) func(*bolt.Tx)
 }
 
 // SaveClient saves the client (identified by it's id) and replaces the values with the values of client.
-func (r *repo) SaveClient(c osin.Client) error {
+func (r *repo) SaveClient(c osin.Client) (err error) {
+	defer r.observe(context.Background(), "SaveClient", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
@@ -168,12 +175,12 @@ func (r *repo) SaveClient(c osin.Client) error {
 		RedirectUri: c.GetRedirectUri(),
 		UserData:    c.GetUserData(),
 	}
-	raw, err := encodeFn(cl)
+	raw, err := r.encode(cl)
 	if err != nil {
 		return errors.Annotatef(err, "Unable to marshal client object")
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
-		rb, err := tx.CreateBucketIfNotExists(r.root)
+	return r.update(func(tx *bolt.Tx) error {
+		rb, err := createRootBucket(tx, r.root)
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s", r.root)
 		}
@@ -181,16 +188,21 @@ func (r *repo) SaveClient(c osin.Client) error {
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s/%s", r.root, clientsBucket)
 		}
-		return cb.Put([]byte(cl.Id), raw)
+		if err = cb.Put([]byte(cl.Id), raw); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpSave, Bucket: clientsBucket, Key: cl.Id})
 	})
 }
 
 // RemoveClient removes a client (identified by id) from the database. Returns an error if something went wrong.
-func (r *repo) RemoveClient(id string) error {
+func (r *repo) RemoveClient(id string) (err error) {
+	defer r.observe(context.Background(), "RemoveClient", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
+	return r.update(func(tx *bolt.Tx) error {
 		rb := tx.Bucket(r.root)
 		if rb == nil {
 			return errors.Errorf("Invalid bucket %s", r.root)
@@ -199,24 +211,53 @@ func (r *repo) RemoveClient(id string) error {
 		if cb == nil {
 			return errors.Newf("Invalid bucket %s/%s", r.root, clientsBucket)
 		}
-		return cb.Delete([]byte(id))
+		if err := cb.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpDelete, Bucket: clientsBucket, Key: id})
 	})
 }
 
 // SaveAuthorize saves authorize data.
-func (r *repo) SaveAuthorize(data *osin.AuthorizeData) error {
+func (r *repo) SaveAuthorize(data *osin.AuthorizeData) (err error) {
+	defer r.observe(context.Background(), "SaveAuthorize", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
 	if data == nil {
 		return errors.Newf("unable to save nil authorization data")
 	}
-	raw, err := encodeFn(data)
+	a := auth{
+		Code:                data.Code,
+		ExpiresIn:           time.Duration(data.ExpiresIn),
+		Scope:               data.Scope,
+		RedirectURI:         data.RedirectUri,
+		State:               data.State,
+		CreatedAt:           data.CreatedAt,
+		CodeChallenge:       data.CodeChallenge,
+		CodeChallengeMethod: data.CodeChallengeMethod,
+	}
+	if data.Client != nil {
+		a.Client = cl{
+			Id:          data.Client.GetId(),
+			Secret:      data.Client.GetSecret(),
+			RedirectUri: data.Client.GetRedirectUri(),
+			UserData:    data.Client.GetUserData(),
+		}
+	}
+	switch ud := data.UserData.(type) {
+	case vocab.IRI:
+		a.UserData = ud
+	case string:
+		a.UserData = vocab.IRI(ud)
+	}
+	raw, err := r.encode(a)
 	if err != nil {
 		return errors.Annotatef(err, "Unable to marshal authorization object")
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
-		rb, err := tx.CreateBucketIfNotExists(r.root)
+	return r.update(func(tx *bolt.Tx) error {
+		rb, err := createRootBucket(tx, r.root)
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s", r.root)
 		}
@@ -224,14 +265,19 @@ func (r *repo) SaveAuthorize(data *osin.AuthorizeData) error {
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s/%s", r.root, authorizeBucket)
 		}
-		return cb.Put([]byte(data.Code), raw)
+		if err = cb.Put([]byte(data.Code), raw); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpSave, Bucket: authorizeBucket, Key: data.Code})
 	})
 }
 
 // LoadAuthorize looks up AuthorizeData by a code.
 // Client information MUST be loaded together.
 // Optionally can return error if expired.
-func (r *repo) LoadAuthorize(code string) (*osin.AuthorizeData, error) {
+func (r *repo) LoadAuthorize(code string) (_ *osin.AuthorizeData, err error) {
+	defer r.observe(context.Background(), "LoadAuthorize", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
@@ -240,7 +286,7 @@ func (r *repo) LoadAuthorize(code string) (*osin.AuthorizeData, error) {
 	}
 	var data osin.AuthorizeData
 
-	err := r.d.View(r.loadAuthorizeFromTx(code, &data))
+	err = r.d.View(r.loadAuthorizeFromTx(code, &data))
 	if err != nil {
 		return nil, err
 	}
@@ -264,7 +310,7 @@ func (r *repo) loadAuthorizeFromTx(code string, data *osin.AuthorizeData) func(t
 		}
 
 		a := auth{}
-		if err := decodeFn(raw, &a); err != nil {
+		if err := r.decode(raw, &a); err != nil {
 			return err
 		}
 		data.Code = a.Code
@@ -279,7 +325,7 @@ func (r *repo) loadAuthorizeFromTx(code string, data *osin.AuthorizeData) func(t
 
 		if data.ExpireAt().Before(time.Now().UTC()) {
 			err := errors.Errorf("Token expired at %s.", data.ExpireAt().String())
-			r.errFn("Authorize code %s: %+s", code, err)
+			r.log().Error("Authorize code expired", "op", "LoadAuthorize", "bucket", authorizeBucket, "err", err)
 			return err
 		}
 
@@ -294,11 +340,13 @@ func (r *repo) loadAuthorizeFromTx(code string, data *osin.AuthorizeData) func(t
 }
 
 // RemoveAuthorize revokes or deletes the authorization code.
-func (r *repo) RemoveAuthorize(code string) error {
+func (r *repo) RemoveAuthorize(code string) (err error) {
+	defer r.observe(context.Background(), "RemoveAuthorize", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
+	return r.update(func(tx *bolt.Tx) error {
 		rb := tx.Bucket(r.root)
 		if rb == nil {
 			return errors.Errorf("Invalid bucket %s", r.root)
@@ -307,13 +355,18 @@ func (r *repo) RemoveAuthorize(code string) error {
 		if cb == nil {
 			return errors.Newf("Invalid bucket %s/%s", r.root, authorizeBucket)
 		}
-		return cb.Delete([]byte(code))
+		if err := cb.Delete([]byte(code)); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpDelete, Bucket: authorizeBucket, Key: code})
 	})
 }
 
 // SaveAccess writes AccessData.
 // If RefreshToken is not blank, it must save in a way that can be loaded using LoadRefresh.
-func (r *repo) SaveAccess(data *osin.AccessData) error {
+func (r *repo) SaveAccess(data *osin.AccessData) (err error) {
+	defer r.observe(context.Background(), "SaveAccess", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
@@ -351,12 +404,12 @@ func (r *repo) SaveAccess(data *osin.AccessData) error {
 		CreatedAt:    data.CreatedAt.UTC(),
 		UserData:     data.UserData,
 	}
-	raw, err := encodeFn(acc)
+	raw, err := r.encode(acc)
 	if err != nil {
 		return errors.Annotatef(err, "Unable to marshal access object")
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
-		rb, err := tx.CreateBucketIfNotExists(r.root)
+	return r.update(func(tx *bolt.Tx) error {
+		rb, err := createRootBucket(tx, r.root)
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s", r.root)
 		}
@@ -364,14 +417,19 @@ func (r *repo) SaveAccess(data *osin.AccessData) error {
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s/%s", r.root, accessBucket)
 		}
-		return cb.Put([]byte(acc.AccessToken), raw)
+		if err = cb.Put([]byte(acc.AccessToken), raw); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpSave, Bucket: accessBucket, Key: acc.AccessToken})
 	})
 }
 
 // LoadAccess retrieves access data by token. Client information MUST be loaded together.
 // AuthorizeData and AccessData DON'T NEED to be loaded if not easily available.
 // Optionally can return error if expired.
-func (r *repo) LoadAccess(code string) (*osin.AccessData, error) {
+func (r *repo) LoadAccess(code string) (_ *osin.AccessData, err error) {
+	defer r.observe(context.Background(), "LoadAccess", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
@@ -380,7 +438,7 @@ func (r *repo) LoadAccess(code string) (*osin.AccessData, error) {
 	}
 	var result osin.AccessData
 
-	err := r.d.View(r.loadAccessFromTx(code, &result, true))
+	err = r.d.View(r.loadAccessFromTx(code, &result, true))
 	if err != nil {
 		return nil, err
 	}
@@ -403,7 +461,7 @@ func (r *repo) loadAccessFromTx(code string, result *osin.AccessData, loadDeps b
 		if raw == nil {
 			return errors.NotFoundf("Unable to load access information for %s/%s/%s", r.root, accessBucket, code)
 		}
-		if err := decodeFn(raw, &access); err != nil {
+		if err := r.decode(raw, &access); err != nil {
 			return errors.Annotatef(err, "Unable to unmarshal access object")
 		}
 		result.AccessToken = access.AccessToken
@@ -428,7 +486,8 @@ func (r *repo) loadAccessFromTx(code string, result *osin.AccessData, loadDeps b
 				a := osin.AuthorizeData{}
 				if err := r.loadAuthorizeFromTx(access.Authorize, &a)(tx); err == nil {
 					if a.ExpireAt().Before(time.Now().UTC()) {
-						r.errFn("Access code %s: %+s", code, errors.Errorf("Token expired at %s.", a.ExpireAt().String()))
+						err := errors.Errorf("Token expired at %s.", a.ExpireAt().String())
+						r.log().Error("Access code expired", "op", "LoadAccess", "bucket", accessBucket, "err", err)
 						return nil
 					}
 					result.AuthorizeData = &a
@@ -447,10 +506,12 @@ func (r *repo) loadAccessFromTx(code string, result *osin.AccessData, loadDeps b
 
 // RemoveAccess revokes or deletes an AccessData.
 func (r *repo) RemoveAccess(code string) (err error) {
+	defer r.observe(context.Background(), "RemoveAccess", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
+	return r.update(func(tx *bolt.Tx) error {
 		rb := tx.Bucket(r.root)
 		if rb == nil {
 			return errors.Errorf("Invalid bucket %s", r.root)
@@ -459,14 +520,19 @@ func (r *repo) RemoveAccess(code string) (err error) {
 		if cb == nil {
 			return errors.Newf("Invalid bucket %s/%s", r.root, accessBucket)
 		}
-		return cb.Delete([]byte(code))
+		if err := cb.Delete([]byte(code)); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpDelete, Bucket: accessBucket, Key: code})
 	})
 }
 
 // LoadRefresh retrieves refresh AccessData. Client information MUST be loaded together.
 // AuthorizeData and AccessData DON'T NEED to be loaded if not easily available.
 // Optionally can return error if expired.
-func (r *repo) LoadRefresh(code string) (*osin.AccessData, error) {
+func (r *repo) LoadRefresh(code string) (_ *osin.AccessData, err error) {
+	defer r.observe(context.Background(), "LoadRefresh", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
@@ -475,7 +541,7 @@ func (r *repo) LoadRefresh(code string) (*osin.AccessData, error) {
 	}
 
 	result := osin.AccessData{}
-	if err := r.d.View(r.loadRefreshFromTx(code, &result)); err != nil {
+	if err = r.d.View(r.loadRefreshFromTx(code, &result)); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -494,7 +560,7 @@ func (r *repo) loadRefreshFromTx(code string, result *osin.AccessData) func(tx *
 		if raw == nil {
 			return errors.NotFoundf("not found")
 		}
-		if err := decodeFn(raw, &ref); err != nil {
+		if err := r.decode(raw, &ref); err != nil {
 			return errors.Annotatef(err, "Unable to unmarshal refresh token object")
 		}
 		if ref.Access == code {
@@ -505,11 +571,13 @@ func (r *repo) loadRefreshFromTx(code string, result *osin.AccessData) func(tx *
 }
 
 // RemoveRefresh revokes or deletes refresh AccessData.
-func (r *repo) RemoveRefresh(code string) error {
+func (r *repo) RemoveRefresh(code string) (err error) {
+	defer r.observe(context.Background(), "RemoveRefresh", "", time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
+	return r.update(func(tx *bolt.Tx) error {
 		rb := tx.Bucket(r.root)
 		if rb == nil {
 			return errors.Errorf("Invalid bucket %s", r.root)
@@ -518,7 +586,10 @@ func (r *repo) RemoveRefresh(code string) error {
 		if cb == nil {
 			return errors.Newf("Invalid bucket %s/%s", r.root, refreshBucket)
 		}
-		return cb.Delete([]byte(code))
+		if err := cb.Delete([]byte(code)); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpDelete, Bucket: refreshBucket, Key: code})
 	})
 }
 
@@ -526,12 +597,12 @@ func (r *repo) saveRefresh(refresh, access string) error {
 	ref := ref{
 		Access: access,
 	}
-	raw, err := encodeFn(ref)
+	raw, err := r.encode(ref)
 	if err != nil {
 		return errors.Annotatef(err, "Unable to marshal refresh token object")
 	}
-	return r.d.Update(func(tx *bolt.Tx) error {
-		rb, err := tx.CreateBucketIfNotExists(r.root)
+	return r.update(func(tx *bolt.Tx) error {
+		rb, err := createRootBucket(tx, r.root)
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s", r.root)
 		}
@@ -539,6 +610,9 @@ func (r *repo) saveRefresh(refresh, access string) error {
 		if err != nil {
 			return errors.Annotatef(err, "Invalid bucket %s/%s", r.root, refreshBucket)
 		}
-		return cb.Put([]byte(refresh), raw)
+		if err = cb.Put([]byte(refresh), raw); err != nil {
+			return err
+		}
+		return r.logChange(rb, Change{Op: OpSave, Bucket: refreshBucket, Key: refresh})
 	})
 }
@@ -0,0 +1,394 @@
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strconv"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	paramAfter    = "after"
+	paramBefore   = "before"
+	paramMaxItems = "maxItems"
+)
+
+// cursor holds the pagination values extracted from the filters.Check list received by Load.
+type cursor struct {
+	after    vocab.IRI
+	before   vocab.IRI
+	maxItems int
+}
+
+func (c cursor) isSet() bool {
+	return c.after != "" || c.before != "" || c.maxItems > 0
+}
+
+// checks returns the pagination checks corresponding to the cursor.
+func (c cursor) checks() filters.Checks {
+	ff := make(filters.Checks, 0, 3)
+	if c.after != "" {
+		ff = append(ff, filters.After(filters.SameID(c.after)))
+	}
+	if c.before != "" {
+		ff = append(ff, filters.Before(filters.SameID(c.before)))
+	}
+	if c.maxItems > 0 {
+		ff = append(ff, filters.WithMaxCount(c.maxItems))
+	}
+	return ff
+}
+
+// isPaginationCheck returns true if the check serializes only to pagination query parameters.
+func isPaginationCheck(c filters.Check) bool {
+	if c == nil {
+		return false
+	}
+	vals := filters.ToValues(c)
+	if len(vals) == 0 {
+		return false
+	}
+	for k := range vals {
+		if k != paramAfter && k != paramBefore && k != paramMaxItems {
+			return false
+		}
+	}
+	return true
+}
+
+// paginationFromChecks splits the pagination checks (After, Before, WithMaxCount) from the rest of the checks.
+// A page loaded using the After or Before checks is limited to filters.MaxItems items, if no WithMaxCount exists.
+func paginationFromChecks(ff ...filters.Check) (cursor, filters.Checks) {
+	cur, rest := cursorFromChecks(ff...)
+	if cur.isSet() && cur.maxItems <= 0 {
+		cur.maxItems = filters.MaxItems
+	}
+	return cur, rest
+}
+
+// cursorFromChecks splits the pagination checks from the rest of the checks, without limiting the number of items.
+func cursorFromChecks(ff ...filters.Check) (cursor, filters.Checks) {
+	cur := cursor{}
+	rest := make(filters.Checks, 0, len(ff))
+	for _, f := range ff {
+		if !isPaginationCheck(f) {
+			rest = append(rest, f)
+			continue
+		}
+		vals := filters.ToValues(f)
+		if after := vals.Get(paramAfter); after != "" {
+			cur.after = vocab.IRI(after)
+		}
+		if before := vals.Get(paramBefore); before != "" {
+			cur.before = vocab.IRI(before)
+		}
+		if maxItems, err := strconv.Atoi(vals.Get(paramMaxItems)); err == nil && maxItems > 0 {
+			cur.maxItems = maxItems
+		}
+	}
+	return cur, rest
+}
+
+func isPaginatedLoad(iri vocab.IRI, ff ...filters.Check) bool {
+	cur, _ := paginationFromChecks(ff...)
+	return cur.isSet() && isStorageCollectionKey(string(itemBucketPath(iri)))
+}
+
+func matchesAll(ff filters.Checks, it vocab.Item) bool {
+	for _, f := range ff {
+		if f != nil && !f.Match(it) {
+			return false
+		}
+	}
+	return true
+}
+
+// lastPathSegment returns the last segment of the bucket path of iri, which is the key of its bucket.
+func lastPathSegment(iri vocab.IRI) []byte {
+	path := bytes.TrimRight(itemBucketPath(iri), string(pathSeparator))
+	if i := bytes.LastIndex(path, pathSeparator); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// isRawItem returns true if the item stored in bucket b is iri.
+func isRawItem(r *repo, b *bolt.Bucket, iri vocab.IRI) bool {
+	it, err := r.loadRawItemFromBucket(b)
+	return err == nil && it.GetLink() == iri
+}
+
+// walkCollection calls fn for every item found in the collection bucket, in storage order, until fn returns false.
+// The items are decoded and dereferenced one at a time, so callers can stop early without loading the whole collection.
+// If after is set, the walk starts with the item following it, and it returns false if after is not in the collection.
+// The cursor is located without decoding the items before it: the members by their sequence key, and the items stored
+// as child buckets by the last segment of their IRI.
+func (r *repo) walkCollection(ctx context.Context, tx *bolt.Tx, b *bolt.Bucket, after vocab.IRI, fn func(vocab.Item) bool, ff ...filters.Check) (bool, error) {
+	rb := tx.Bucket(r.root)
+	if rb == nil {
+		return false, ErrorInvalidRoot(r.root)
+	}
+
+	matcherFn := filters.RawMatcher(ff)
+	emitIRI := func(iri vocab.IRI) bool {
+		it, err := r.loadItemElementTx(ctx, tx, rb, iri, matcherFn, ff...)
+		if err != nil || vocab.IsNil(it) {
+			return true
+		}
+		return fn(it)
+	}
+
+	c := b.Cursor()
+	if c == nil {
+		return false, errors.Errorf("Invalid bucket cursor")
+	}
+	key, _ := c.First()
+	var from []byte
+	if after != "" {
+		if from = memberKey(b, after); from != nil {
+			key = nil
+		} else if ob := b.Bucket(lastPathSegment(after)); ob != nil && isRawItem(r, ob, after) {
+			key, _ = c.Seek(lastPathSegment(after))
+			key, _ = c.Next()
+		} else {
+			return false, nil
+		}
+	}
+
+	for ; key != nil; key, _ = c.Next() {
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+		if isReservedKey(key) {
+			continue
+		}
+		ob := b.Bucket(key)
+		if ob == nil {
+			continue
+		}
+		it, err := r.loadItem(ctx, tx, ob, matcherFn, ff...)
+		if err != nil || vocab.IsNil(it) || vocab.IsCollection(it) {
+			continue
+		}
+		if !fn(it) {
+			return true, nil
+		}
+	}
+
+	ib := b.Bucket([]byte(itemsBucket))
+	if ib == nil {
+		return true, nil
+	}
+	ic := ib.Cursor()
+	k, v := ic.First()
+	if from != nil {
+		if k, v = ic.Seek(from); k != nil && bytes.Equal(k, from) {
+			k, v = ic.Next()
+		}
+	}
+	for ; k != nil; k, v = ic.Next() {
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+		if !emitIRI(vocab.IRI(v)) {
+			return true, nil
+		}
+	}
+	return true, nil
+}
+
+// walkCollectionBackwards calls fn for every member stored before the from sequence key, in reverse storage order,
+// until fn returns false.
+func (r *repo) walkCollectionBackwards(ctx context.Context, tx *bolt.Tx, b *bolt.Bucket, from []byte, fn func(vocab.Item) bool, ff ...filters.Check) error {
+	rb := tx.Bucket(r.root)
+	if rb == nil {
+		return ErrorInvalidRoot(r.root)
+	}
+	ib := b.Bucket([]byte(itemsBucket))
+	if ib == nil {
+		return nil
+	}
+
+	matcherFn := filters.RawMatcher(ff)
+	c := ib.Cursor()
+	k, v := c.Seek(from)
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	for ; k != nil; k, v = c.Prev() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		it, err := r.loadItemElementTx(ctx, tx, rb, vocab.IRI(v), matcherFn, ff...)
+		if err != nil || vocab.IsNil(it) {
+			continue
+		}
+		if !fn(it) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// paginate collects a page of the items produced by walk, which calls its argument for every item of the
+// collection, in order, until it returns false.
+// It returns the page items, and if there are items before, or after, the page.
+func paginate(walk func(func(vocab.Item) bool) error, cur cursor, ff filters.Checks) (vocab.ItemCollection, bool, bool, error) {
+	items := make(vocab.ItemCollection, 0, cur.maxItems)
+	hasPrev, hasNext := false, false
+	started := cur.after == ""
+	err := walk(func(it vocab.Item) bool {
+		if !started {
+			// NOTE: we skip everything up to, and including, the "after" cursor
+			started = it.GetLink() == cur.after
+			hasPrev = started
+			return true
+		}
+		if cur.before != "" && it.GetLink() == cur.before {
+			hasNext = true
+			return false
+		}
+		if !matchesAll(ff, it) {
+			return true
+		}
+		if cur.before != "" {
+			// NOTE: when paginating backwards we keep only the last maxItems elements before the cursor
+			if len(items) == cur.maxItems {
+				items = items[1:]
+				hasPrev = true
+			}
+			items = append(items, it)
+			return true
+		}
+		if len(items) == cur.maxItems {
+			hasNext = true
+			return false
+		}
+		items = append(items, it)
+		return true
+	})
+	return items, hasPrev, hasNext, err
+}
+
+// loadCollectionPage loads a single page of the collection stored in bucket b, starting from the cursor position
+// and stopping as soon as the page is full.
+func (r *repo) loadCollectionPage(ctx context.Context, tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, cur cursor, ff ...filters.Check) (vocab.Item, error) {
+	if b == nil {
+		return nil, errors.Errorf("invalid bucket to load from")
+	}
+	rb := tx.Bucket(r.root)
+	if rb == nil {
+		return nil, ErrorInvalidRoot(r.root)
+	}
+	col, err := r.loadRawItemFromBucket(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan := planQuery(rb, b, ff...); plan != nil {
+		entries := plan.collectionEntries(rb, b, iri)
+		items, hasPrev, hasNext, err := paginate(r.walkIndexEntries(ctx, tx, rb, entries, ff...), cur, ff)
+		if err != nil {
+			return nil, err
+		}
+		return buildPage(col, iri, items, cur, hasPrev, hasNext)
+	}
+
+	if cur.before != "" {
+		if key := memberKey(b, cur.before); key != nil {
+			// NOTE: the cursor is a member of the collection, so we can seek to it and walk backwards
+			items := make(vocab.ItemCollection, 0, cur.maxItems)
+			hasPrev := false
+			err = r.walkCollectionBackwards(ctx, tx, b, key, func(it vocab.Item) bool {
+				if !matchesAll(ff, it) {
+					return true
+				}
+				if len(items) == cur.maxItems {
+					hasPrev = true
+					return false
+				}
+				items = append(items, it)
+				return true
+			}, ff...)
+			if err != nil {
+				return nil, err
+			}
+			slices.Reverse(items)
+			return buildPage(col, iri, items, cur, hasPrev, true)
+		}
+	}
+
+	// NOTE: the walk starts right after the "after" cursor, which is located without decoding the items
+	// before it, and the "before" cursor, which isn't a member of the collection, is found by walking up to it.
+	found := false
+	walk := func(fn func(vocab.Item) bool) error {
+		found, err = r.walkCollection(ctx, tx, b, cur.after, fn, ff...)
+		return err
+	}
+	items, hasPrev, hasNext, err := paginate(walk, cursor{before: cur.before, maxItems: cur.maxItems}, ff)
+	if err != nil {
+		return nil, err
+	}
+	return buildPage(col, iri, items, cur, hasPrev || (cur.after != "" && found), hasNext)
+}
+
+func pageIRI(iri vocab.IRI, ff ...filters.Check) vocab.IRI {
+	return vocab.IRI(string(iri) + "?" + filters.ToValues(ff...).Encode())
+}
+
+// buildPage wraps the loaded items in an OrderedCollectionPage, or a CollectionPage for unordered collections,
+// identified by the IRI of the current cursor, and sets the first/next/prev links.
+// The page loaded without an After or Before cursor keeps the IRI of the collection.
+func buildPage(col vocab.Item, iri vocab.IRI, items vocab.ItemCollection, cur cursor, hasPrev, hasNext bool) (vocab.Item, error) {
+	var first, next, prev vocab.Item
+	id := iri
+	if cur.after != "" || cur.before != "" {
+		id = pageIRI(iri, cur.checks()...)
+	}
+	first = pageIRI(iri, filters.WithMaxCount(cur.maxItems))
+	if len(items) > 0 {
+		if hasNext {
+			next = pageIRI(iri, filters.After(filters.SameID(items[len(items)-1].GetLink())), filters.WithMaxCount(cur.maxItems))
+		}
+		if hasPrev {
+			prev = pageIRI(iri, filters.Before(filters.SameID(items[0].GetLink())), filters.WithMaxCount(cur.maxItems))
+		}
+	}
+
+	if !orderedCollectionTypes.Match(col.GetType()) {
+		page := &vocab.CollectionPage{ID: id, Type: vocab.CollectionPageType, PartOf: iri, First: first, Next: next, Prev: prev}
+		if len(items) > 0 {
+			page.Items = items
+		}
+		err := vocab.OnCollection(col, func(c *vocab.Collection) error {
+			page.AttributedTo = c.AttributedTo
+			page.Published = c.Published
+			page.Updated = c.Updated
+			page.CC = c.CC
+			page.TotalItems = c.TotalItems
+			return nil
+		})
+		return page, err
+	}
+
+	page := &vocab.OrderedCollectionPage{ID: id, Type: vocab.OrderedCollectionPageType, PartOf: iri, First: first, Next: next, Prev: prev}
+	if len(items) > 0 {
+		page.OrderedItems = items
+	}
+	err := vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
+		page.AttributedTo = c.AttributedTo
+		page.Published = c.Published
+		page.Updated = c.Updated
+		page.CC = c.CC
+		page.TotalItems = c.TotalItems
+		return nil
+	})
+	return page, err
+}
@@ -0,0 +1,238 @@
+package boltdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+func Test_paginationFromChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		ff       filters.Checks
+		want     cursor
+		wantRest int
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "no pagination",
+			ff:       filters.Checks{filters.HasType(vocab.CreateType)},
+			wantRest: 1,
+		},
+		{
+			name: "max items",
+			ff:   filters.Checks{filters.WithMaxCount(10)},
+			want: cursor{maxItems: 10},
+		},
+		{
+			name: "after with default max items",
+			ff:   filters.Checks{filters.After(filters.SameID("https://example.com/1"))},
+			want: cursor{after: "https://example.com/1", maxItems: filters.MaxItems},
+		},
+		{
+			name:     "before, max items and type",
+			ff:       filters.Checks{filters.HasType(vocab.CreateType), filters.Before(filters.SameID("https://example.com/1")), filters.WithMaxCount(2)},
+			want:     cursor{before: "https://example.com/1", maxItems: 2},
+			wantRest: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest := paginationFromChecks(tt.ff...)
+			if got != tt.want {
+				t.Errorf("paginationFromChecks() got = %+v, want %+v", got, tt.want)
+			}
+			if len(rest) != tt.wantRest {
+				t.Errorf("paginationFromChecks() remaining checks = %d, want %d", len(rest), tt.wantRest)
+			}
+		})
+	}
+}
+
+func wantsRootOutboxCursorPage(fil filters.Checks, maxItems int, items vocab.ItemCollection, hasPrev, hasNext bool) vocab.Item {
+	id := rootOutboxIRI
+	if cur, _ := paginationFromChecks(fil...); cur.after != "" || cur.before != "" {
+		id = pageIRI(rootOutboxIRI, fil...)
+	}
+	page := &vocab.OrderedCollectionPage{
+		ID:           id,
+		Type:         vocab.OrderedCollectionPageType,
+		AttributedTo: rootIRI,
+		Published:    publishedTime,
+		CC:           vocab.ItemCollection{vocab.IRI("https://www.w3.org/ns/activitystreams#Public")},
+		PartOf:       rootOutboxIRI,
+		First:        pageIRI(rootOutboxIRI, filters.WithMaxCount(maxItems)),
+		TotalItems:   allActivities.Load().Count(),
+	}
+	if len(items) > 0 {
+		page.OrderedItems = items
+	}
+	if hasNext {
+		page.Next = pageIRI(rootOutboxIRI, filters.After(filters.SameID(items[len(items)-1].GetLink())), filters.WithMaxCount(maxItems))
+	}
+	if hasPrev {
+		page.Prev = pageIRI(rootOutboxIRI, filters.Before(filters.SameID(items[0].GetLink())), filters.WithMaxCount(maxItems))
+	}
+	return page
+}
+
+func Test_repo_Load_Pagination(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withGeneratedMocks)
+	t.Cleanup(r.Close)
+
+	activities := *allActivities.Load()
+	firstPage := filters.Checks{filters.WithMaxCount(2)}
+	secondPage := filters.Checks{filters.After(filters.SameID(activities[1].GetLink())), filters.WithMaxCount(2)}
+	beforeFifth := filters.Checks{filters.Before(filters.SameID(activities[4].GetLink())), filters.WithMaxCount(2)}
+	lastPage := filters.Checks{filters.After(filters.SameID(activities[len(activities)-3].GetLink())), filters.WithMaxCount(5)}
+	unknownCursor := filters.Checks{filters.After(filters.SameID("https://example.com/missing")), filters.WithMaxCount(2)}
+	tests := []struct {
+		name    string
+		fil     filters.Checks
+		want    vocab.Item
+		wantErr error
+	}{
+		{
+			name: "first page",
+			fil:  firstPage,
+			want: wantsRootOutboxCursorPage(firstPage, 2, activities[:2], false, true),
+		},
+		{
+			name: "second page",
+			fil:  secondPage,
+			want: wantsRootOutboxCursorPage(secondPage, 2, activities[2:4], true, true),
+		},
+		{
+			name: "page before the fifth item",
+			fil:  beforeFifth,
+			want: wantsRootOutboxCursorPage(beforeFifth, 2, activities[2:4], true, true),
+		},
+		{
+			name: "last page",
+			fil:  lastPage,
+			want: wantsRootOutboxCursorPage(lastPage, 5, activities[len(activities)-2:], true, false),
+		},
+		{
+			name: "unknown cursor",
+			fil:  unknownCursor,
+			want: wantsRootOutboxCursorPage(unknownCursor, 2, nil, false, false),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Load(rootOutboxIRI, tt.fil...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !cmp.Equal(tt.want, got, EquateItemCollections) {
+				t.Errorf("Load() got = %s", cmp.Diff(tt.want, got, EquateItemCollections))
+			}
+		})
+	}
+}
+
+func Test_repo_walkCollection(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	children := make(vocab.ItemCollection, 0, 4)
+	for i := range 4 {
+		children = append(children, &vocab.Object{ID: colIRI.AddPath(strconv.Itoa(i)), Type: vocab.NoteType})
+	}
+	members := vocab.ItemCollection{
+		&vocab.Object{ID: "https://example.com/members/1", Type: vocab.NoteType},
+		&vocab.Object{ID: "https://example.com/members/2", Type: vocab.NoteType},
+	}
+	withMembers := func(t *testing.T, r *repo) *repo {
+		for _, it := range members {
+			if _, err := r.Save(it); err != nil {
+				t.Errorf("unable to save item %s: %s", it.GetLink(), err)
+			}
+			if err := r.AddTo(colIRI, it.GetLink()); err != nil {
+				t.Errorf("unable to add item to collection %s -> %s : %s", it.GetLink(), colIRI, err)
+			}
+		}
+		return r
+	}
+	withChildren := func(t *testing.T, r *repo) *repo {
+		for _, it := range children {
+			if _, err := r.Save(it); err != nil {
+				t.Errorf("unable to save item %s: %s", it.GetLink(), err)
+			}
+		}
+		return r
+	}
+	all := append(append(vocab.IRIs{}, children.IRIs()...), members.IRIs()...)
+
+	tests := []struct {
+		name      string
+		after     vocab.IRI
+		want      vocab.IRIs
+		wantFound bool
+	}{
+		{
+			name:      "from the start",
+			want:      all,
+			wantFound: true,
+		},
+		{
+			name:      "after a child bucket",
+			after:     children[1].GetLink(),
+			want:      all[2:],
+			wantFound: true,
+		},
+		{
+			name:      "after the last child bucket",
+			after:     children[3].GetLink(),
+			want:      members.IRIs(),
+			wantFound: true,
+		},
+		{
+			name:      "after a member",
+			after:     members[0].GetLink(),
+			want:      members.IRIs()[1:],
+			wantFound: true,
+		},
+		{
+			name:  "after a missing item",
+			after: colIRI.AddPath("missing"),
+			want:  vocab.IRIs{},
+		},
+	}
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withChildren, withMembers)
+	t.Cleanup(r.Close)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(vocab.IRIs, 0)
+			var found bool
+			err := r.d.View(func(tx *bolt.Tx) error {
+				b, _, err := r.collectionBucket(tx, colIRI)
+				if err != nil {
+					return err
+				}
+				found, err = r.walkCollection(context.Background(), tx, b, tt.after, func(it vocab.Item) bool {
+					got = append(got, it.GetLink())
+					return true
+				})
+				return err
+			})
+			if err != nil {
+				t.Fatalf("walkCollection() error = %s", err)
+			}
+			if found != tt.wantFound {
+				t.Errorf("walkCollection() found = %t, want %t", found, tt.wantFound)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("walkCollection() items %s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
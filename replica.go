@@ -0,0 +1,308 @@
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	bolt "go.etcd.io/bbolt"
+)
+
+// replicaSeqKey holds, in the root bucket of a replica, the sequence of the last change applied from the primary.
+const replicaSeqKey = "__replica_seq"
+
+// replicaBatchSize is the number of changes a Replica applies in a single transaction.
+const replicaBatchSize = 1000
+
+// ErrorChangelogIncomplete is returned by NewReplica when the primary's changelog doesn't hold all the changes made
+// to it, because it was enabled on a store which already had data, or because of a RotateEncryptionKey or Repair.
+// The replica needs to be created with BootstrapReplica.
+var ErrorChangelogIncomplete = errors.Newf("the changelog of the primary doesn't hold all its changes, the replica needs to be bootstrapped")
+
+// Replica applies the changelog of a primary repository, which needs to have the Changelog enabled, to a second
+// database.
+// The replica database has the same layout as the primary, so, once the Replica is closed, it can be opened
+// in read-only mode as a regular repository. While it's running, its Load method serves the reads.
+// NOTE: the values are copied as they are stored in the primary, so the replica needs to use the same
+// CompressionDictionary and encryption key.
+type Replica struct {
+	mu      sync.Mutex
+	primary *repo
+	r       *repo
+}
+
+// NewReplica opens, or creates, the replica database described by conf, following the primary.
+// A replica which hasn't been bootstrapped, nor applied any change yet, can only follow a primary whose changelog holds all its changes,
+// otherwise it returns ErrorChangelogIncomplete.
+func NewReplica(primary *repo, conf Config) (*Replica, error) {
+	rep, err := newReplica(primary, conf)
+	if err != nil {
+		return nil, err
+	}
+	started, err := rep.started()
+	if err == nil && !started {
+		var complete bool
+		if complete, err = primary.isChangelogComplete(); err == nil && !complete {
+			err = ErrorChangelogIncomplete
+		}
+	}
+	if err != nil {
+		rep.Close()
+		return nil, err
+	}
+	return rep, nil
+}
+
+func newReplica(primary *repo, conf Config) (*Replica, error) {
+	if primary == nil || primary.d == nil {
+		return nil, errNotOpen
+	}
+	r, err := New(conf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(r.path); os.IsNotExist(err) {
+		if err = Bootstrap(conf); err != nil {
+			return nil, err
+		}
+	}
+	if err = r.Open(); err != nil {
+		return nil, err
+	}
+	// NOTE: the deletes need to be replayed the same way they were done in the primary, including the removal
+	// of the deleted items from the collections they belonged to
+	r.deleteMode = primary.deleteMode
+	r.deleteFromCollections = primary.deleteFromCollections
+	return &Replica{primary: primary, r: r}, nil
+}
+
+// BootstrapReplica replaces the replica database described by conf with a Backup snapshot of the primary,
+// and returns a Replica following the primary from the last change contained in the snapshot.
+func BootstrapReplica(primary *repo, conf Config) (*Replica, error) {
+	if primary == nil || primary.d == nil {
+		return nil, errNotOpen
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := primary.Backup(pw)
+		_ = pw.CloseWithError(err)
+	}()
+	if err := Restore(conf, pr); err != nil {
+		_ = pr.CloseWithError(err)
+		return nil, errors.Annotatef(err, "unable to restore primary snapshot")
+	}
+
+	rep, err := newReplica(primary, conf)
+	if err != nil {
+		return nil, err
+	}
+	err = rep.r.update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(rep.r.root)
+		if root == nil {
+			return ErrorInvalidRoot(rep.r.root)
+		}
+		// NOTE: the sequence of the snapshot's changelog is the last change contained in it
+		seq := uint64(0)
+		if cb := root.Bucket([]byte(changelogBucket)); cb != nil {
+			seq = cb.Sequence()
+			if err := root.DeleteBucket([]byte(changelogBucket)); err != nil {
+				return err
+			}
+		}
+		if err := changelogIncomplete(root); err != nil {
+			return err
+		}
+		return root.Put([]byte(replicaSeqKey), itob(seq))
+	})
+	if err != nil {
+		rep.Close()
+		return nil, err
+	}
+	return rep, nil
+}
+
+// LastApplied returns the sequence of the last change of the primary applied to the replica.
+func (rep *Replica) LastApplied() (uint64, error) {
+	seq := uint64(0)
+	err := rep.r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(rep.r.root)
+		if root == nil {
+			return ErrorInvalidRoot(rep.r.root)
+		}
+		if v := root.Get([]byte(replicaSeqKey)); len(v) == 8 {
+			seq = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+	return seq, err
+}
+
+// started returns true if the replica has been bootstrapped, or it has applied changes from the primary.
+func (rep *Replica) started() (bool, error) {
+	started := false
+	err := rep.r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(rep.r.root)
+		if root == nil {
+			return ErrorInvalidRoot(rep.r.root)
+		}
+		started = root.Get([]byte(replicaSeqKey)) != nil
+		return nil
+	})
+	return started, err
+}
+
+// Sync applies all the changes of the primary following the last applied one, and returns their number.
+// If the primary's changelog has been truncated past the last applied change, it returns ErrorChangesTruncated,
+// and the replica needs to be bootstrapped again.
+func (rep *Replica) Sync() (int, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	since, err := rep.LastApplied()
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	for {
+		count := 0
+		// NOTE: the changes of a batch, and the values they refer to, are read from the same snapshot of the primary
+		err = rep.primary.d.View(func(ptx *bolt.Tx) error {
+			proot := ptx.Bucket(rep.primary.root)
+			if proot == nil {
+				return ErrorInvalidRoot(rep.primary.root)
+			}
+			changes, err := rep.primary.readChanges(proot, since, replicaBatchSize)
+			if err != nil || len(changes) == 0 {
+				return err
+			}
+			err = rep.r.update(func(tx *bolt.Tx) error {
+				root, err := rootFromTx(tx, rep.r.root)
+				if err != nil {
+					return err
+				}
+				for _, c := range changes {
+					if err := rep.apply(tx, root, proot, c); err != nil {
+						return errors.Annotatef(err, "unable to apply change %d, %s %s", c.Seq, c.Op, c.IRI)
+					}
+				}
+				return root.Put([]byte(replicaSeqKey), itob(changes[len(changes)-1].Seq))
+			})
+			if err == nil {
+				count, since = len(changes), changes[len(changes)-1].Seq
+			}
+			return err
+		})
+		if err != nil || count == 0 {
+			return applied, err
+		}
+		applied += count
+	}
+}
+
+// Follow runs Sync every interval, and after the primary commits new changes, until ctx is done.
+func (rep *Replica) Follow(ctx context.Context, interval time.Duration) error {
+	events, cancel := rep.primary.Subscribe(nil)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := rep.Sync(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		}
+	}
+}
+
+// Load loads the item identified by iri from the replica.
+func (rep *Replica) Load(iri vocab.IRI, ff ...filters.Check) (vocab.Item, error) {
+	return rep.r.Load(iri, ff...)
+}
+
+// Close closes the replica database.
+func (rep *Replica) Close() {
+	rep.r.Close()
+}
+
+// itemValue returns a copy of the key value stored in the bucket of the iri item.
+func itemValue(root *bolt.Bucket, iri vocab.IRI, key string) []byte {
+	b, remainder, err := descendInBucket(root, itemBucketPath(iri), false)
+	if err != nil || len(remainder) > 0 {
+		return nil
+	}
+	return bytes.Clone(b.Get([]byte(key)))
+}
+
+// apply applies the change c to the replica. The objects, metadata and OAuth2 data are copied from the proot
+// snapshot of the primary, so they are skipped if they have been removed from it since the change.
+func (rep *Replica) apply(tx *bolt.Tx, root, proot *bolt.Bucket, c Change) error {
+	if c.Bucket != "" {
+		var raw []byte
+		if pb := proot.Bucket([]byte(c.Bucket)); pb != nil {
+			raw = bytes.Clone(pb.Get([]byte(c.Key)))
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(c.Bucket))
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			return b.Delete([]byte(c.Key))
+		}
+		return b.Put([]byte(c.Key), raw)
+	}
+
+	switch c.Op {
+	case OpSave:
+		raw := itemValue(proot, c.IRI, objectKey)
+		if raw == nil {
+			return nil
+		}
+		it, err := rep.primary.decodeItem(raw)
+		if err != nil {
+			return err
+		}
+		return saveTx(rep.r, tx, it)
+	case OpSaveMetadata:
+		raw := itemValue(proot, c.IRI, metaDataKey)
+		if raw == nil {
+			return nil
+		}
+		b, _, err := descendInBucket(root, itemBucketPath(c.IRI), true)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(metaDataKey), raw)
+	case OpAddTo:
+		var it vocab.Item = c.IRI
+		if !objectExists(root, c.IRI) {
+			// NOTE: the primary can have members which are not stored, or have been deleted since the
+			// change, and we don't want addToTx to try to load them
+			it = &vocab.Object{ID: c.IRI}
+		}
+		_, err := rep.r.addToTx(context.Background(), tx, c.Collection, it)
+		return err
+	case OpRemoveFrom:
+		return rep.r.removeFromTx(context.Background(), tx, c.Collection, c.IRI)
+	case OpDelete:
+		if !objectExists(root, c.IRI) {
+			return nil
+		}
+		return deleteItem(rep.r, tx, c.IRI)
+	}
+	return errors.Newf("unknown operation %q", c.Op)
+}
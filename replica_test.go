@@ -0,0 +1,250 @@
+package boltdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/openshift/osin"
+)
+
+func Test_Replica_Sync(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+
+	primary := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withChangelog(0), withOrderedCollection(colIRI))
+	t.Cleanup(primary.Close)
+
+	rep, err := NewReplica(primary, Config{Path: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewReplica() error = %s", err)
+	}
+	t.Cleanup(rep.Close)
+
+	if _, err = primary.Save(note); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if err = primary.AddTo(colIRI, note.ID); err != nil {
+		t.Fatalf("AddTo() error = %s", err)
+	}
+	if err = primary.SaveMetadata(note.ID, &Metadata{Pw: defaultPw}); err != nil {
+		t.Fatalf("SaveMetadata() error = %s", err)
+	}
+	if err = primary.SaveClient(&osin.DefaultClient{Id: "client", RedirectUri: "https://example.com"}); err != nil {
+		t.Fatalf("SaveClient() error = %s", err)
+	}
+
+	applied, err := rep.Sync()
+	if err != nil {
+		t.Fatalf("Sync() error = %s", err)
+	}
+	if applied != 5 {
+		t.Errorf("Sync() applied %d changes, want %d", applied, 5)
+	}
+	if seq, _ := rep.LastApplied(); seq != 5 {
+		t.Errorf("LastApplied() = %d, want %d", seq, 5)
+	}
+	if _, err = rep.Load(note.ID); err != nil {
+		t.Errorf("Load() from replica error = %s", err)
+	}
+	col, err := rep.Load(colIRI)
+	if err != nil {
+		t.Fatalf("Load() of collection from replica error = %s", err)
+	}
+	if err = vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
+		if c.TotalItems != 1 || len(c.OrderedItems) != 1 {
+			t.Errorf("Load() of collection from replica has %d/%d items, want 1", c.TotalItems, len(c.OrderedItems))
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("invalid collection %s", err)
+	}
+	if _, err = rep.r.GetClient("client"); err != nil {
+		t.Errorf("GetClient() from replica error = %s", err)
+	}
+
+	if err = primary.Delete(note); err != nil {
+		t.Fatalf("Delete() error = %s", err)
+	}
+	if applied, err = rep.Sync(); err != nil || applied != 1 {
+		t.Fatalf("Sync() = %d, %v", applied, err)
+	}
+	if _, err = rep.Load(note.ID); !errors.IsNotFound(err) {
+		t.Errorf("Load() of deleted item from replica error = %v, want not found", err)
+	}
+
+	t.Run("delete removes from collections", func(t *testing.T) {
+		primary := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withChangelog(0), withOrderedCollection(colIRI))
+		t.Cleanup(primary.Close)
+		primary.deleteFromCollections = true
+
+		rep, err := NewReplica(primary, Config{Path: t.TempDir()})
+		if err != nil {
+			t.Fatalf("NewReplica() error = %s", err)
+		}
+		t.Cleanup(rep.Close)
+
+		if _, err = primary.Save(note); err != nil {
+			t.Fatalf("Save() error = %s", err)
+		}
+		if err = primary.AddTo(colIRI, note.ID); err != nil {
+			t.Fatalf("AddTo() error = %s", err)
+		}
+		if err = primary.Delete(note); err != nil {
+			t.Fatalf("Delete() error = %s", err)
+		}
+		if _, err = rep.Sync(); err != nil {
+			t.Fatalf("Sync() error = %s", err)
+		}
+		col, err := rep.Load(colIRI)
+		if err != nil {
+			t.Fatalf("Load() of collection from replica error = %s", err)
+		}
+		_ = vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
+			if c.TotalItems != 0 || len(c.OrderedItems) != 0 {
+				t.Errorf("Load() of collection from replica has %d/%d items, want 0", c.TotalItems, len(c.OrderedItems))
+			}
+			return nil
+		})
+		if cols, err := rep.r.ContainedIn(note.ID); err != nil || len(cols) != 0 {
+			t.Errorf("ContainedIn() on replica = %v, %v, want no collections", cols, err)
+		}
+	})
+}
+
+func TestNewReplica_ChangelogIncomplete(t *testing.T) {
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	tests := []struct {
+		name    string
+		initFns []initFn
+		fn      func(*repo) error
+		wantErr error
+	}{
+		{
+			name:    "changelog enabled on empty store",
+			initFns: []initFn{withOpenRoot, withBootstrap, withChangelog(0)},
+		},
+		{
+			name:    "changelog enabled after saving items",
+			initFns: []initFn{withOpenRoot, withBootstrap, withMockItems, withChangelog(0)},
+			wantErr: ErrorChangelogIncomplete,
+		},
+		{
+			name:    "changes made with the changelog disabled",
+			initFns: []initFn{withOpenRoot, withBootstrap, withChangelog(0)},
+			fn: func(r *repo) error {
+				r.changelog = false
+				_, err := r.Save(note)
+				return err
+			},
+			wantErr: ErrorChangelogIncomplete,
+		},
+		{
+			name:    "encryption key rotated",
+			initFns: []initFn{withOpenRoot, withBootstrap, withChangelog(0)},
+			fn: func(r *repo) error {
+				return r.RotateEncryptionKey(nil, []byte("0123456789abcdef0123456789abcdef"))
+			},
+			wantErr: ErrorChangelogIncomplete,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := mockRepo(t, fields{path: t.TempDir()}, tt.initFns...)
+			t.Cleanup(primary.Close)
+			if tt.fn != nil {
+				if err := tt.fn(primary); err != nil {
+					t.Fatalf("unable to change primary: %s", err)
+				}
+			}
+
+			rep, err := NewReplica(primary, Config{Path: t.TempDir()})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewReplica() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			t.Cleanup(rep.Close)
+		})
+	}
+}
+
+func TestBootstrapReplica(t *testing.T) {
+	primary := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withChangelog(0), withMockItems)
+	t.Cleanup(primary.Close)
+
+	conf := Config{Path: t.TempDir()}
+	rep, err := BootstrapReplica(primary, conf)
+	if err != nil {
+		t.Fatalf("BootstrapReplica() error = %s", err)
+	}
+	changes, _ := primary.ReadChanges(0, 0)
+	if seq, _ := rep.LastApplied(); seq != changes[len(changes)-1].Seq {
+		t.Errorf("LastApplied() = %d, want %d", seq, changes[len(changes)-1].Seq)
+	}
+	if applied, err := rep.Sync(); err != nil || applied != 0 {
+		t.Errorf("Sync() after bootstrap = %d, %v, want no changes", applied, err)
+	}
+
+	note := &vocab.Object{ID: "https://example.com/objects/new", Type: vocab.NoteType}
+	if _, err = primary.Save(note); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if applied, err := rep.Sync(); err != nil || applied != 1 {
+		t.Errorf("Sync() = %d, %v, want one change", applied, err)
+	}
+	rep.Close()
+
+	// NOTE: the closed replica can be opened as a regular read-only repository
+	conf.ReadOnly = true
+	r, _ := New(conf)
+	if err = r.Open(); err != nil {
+		t.Fatalf("Open() of replica error = %s", err)
+	}
+	t.Cleanup(r.Close)
+	for _, it := range append(mockItems, note) {
+		if vocab.IsIRI(it) {
+			continue
+		}
+		if _, err = r.Load(it.GetLink()); err != nil {
+			t.Errorf("Load() of %s from replica error = %s", it.GetLink(), err)
+		}
+	}
+}
+
+func Test_Replica_Follow(t *testing.T) {
+	primary := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withChangelog(0))
+	t.Cleanup(primary.Close)
+
+	rep, err := NewReplica(primary, Config{Path: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewReplica() error = %s", err)
+	}
+	t.Cleanup(rep.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- rep.Follow(ctx, time.Minute)
+	}()
+
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	if _, err = primary.Save(note); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, err = rep.Load(note.ID); err != nil && time.Now().Before(deadline); _, err = rep.Load(note.ID) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("Load() from followed replica error = %s", err)
+	}
+
+	cancel()
+	if err = <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Follow() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -2,8 +2,12 @@ package boltdb
 
 import (
 	"bytes"
+	"context"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	vocab "github.com/go-ap/activitypub"
@@ -16,11 +20,34 @@ var encodeItemFn = vocab.MarshalJSON
 var decodeItemFn = vocab.UnmarshalJSON
 
 type repo struct {
-	d     *bolt.DB
-	root  []byte
-	path  string
-	logFn loggerFn
-	errFn loggerFn
+	d      *bolt.DB
+	root   []byte
+	path   string
+	logFn  loggerFn
+	errFn  loggerFn
+	logger *slog.Logger
+
+	deleteMode            DeleteMode
+	deleteFromCollections bool
+	keepHistory           bool
+	maxRevisions          int
+	codec                 Codec
+	compression           Compression
+	dictionary            []byte
+	keys                  KeyProvider
+	keysMu                sync.RWMutex
+
+	fileMode os.FileMode
+	options  bolt.Options
+
+	events eventBus
+
+	changelog          bool
+	changelogRetention int
+
+	observer      Observer
+	statsInterval time.Duration
+	stopStats     func()
 }
 
 type loggerFn func(string, ...interface{})
@@ -34,9 +61,55 @@ const (
 
 // Config
 type Config struct {
-	Path  string
-	LogFn loggerFn
-	ErrFn loggerFn
+	Path string
+	// Logger is the structured logger used by the repository. When it's nil the log records are formatted,
+	// and passed to the LogFn and ErrFn functions.
+	Logger *slog.Logger
+	LogFn  loggerFn
+	ErrFn  loggerFn
+	// DeleteMode chooses between removing the deleted objects, and replacing them with a Tombstone.
+	DeleteMode DeleteMode
+	// DeleteFromCollections makes Delete remove the items from all the collections they have been added to.
+	DeleteFromCollections bool
+	// KeepHistory enables storing the previous versions of the objects when they get updated.
+	KeepHistory bool
+	// MaxRevisions limits the number of previous versions kept for every object, zero means no limit.
+	MaxRevisions int
+	// Codec encodes the values stored in the database, by default they are stored as JSON.
+	Codec Codec
+	// Compression chooses the algorithm used for compressing the stored objects and metadata.
+	Compression Compression
+	// CompressionDictionary is an optional dictionary of byte sequences common to the stored values,
+	// used by the flate compression. The values compressed with it can only be read back using the same dictionary.
+	CompressionDictionary []byte
+	// EncryptionKey is the AES key-encryption key used for sealing the stored metadata, which holds the actors'
+	// private keys and passwords. When it's empty the metadata is stored unencrypted.
+	EncryptionKey []byte
+	// KeyProvider returns the key-encryption key, it takes precedence over the EncryptionKey.
+	KeyProvider KeyProvider
+
+	// Timeout is the amount of time to wait for the lock on the database file, zero means waiting indefinitely.
+	Timeout time.Duration
+	// ReadOnly opens the database in read-only mode, using a shared lock, and rejects all the writes.
+	ReadOnly bool
+	// NoSync skips the fsync after every commit, it should only be used for bulk loads.
+	NoSync bool
+	// NoFreelistSync skips syncing the freelist to disk, which speeds up the writes, but slows down the recovery.
+	NoFreelistSync bool
+	// InitialMmapSize is the initial size, in bytes, of the memory map of the database file.
+	InitialMmapSize int
+	// FileMode is the mode used for creating the database file, by default 0600.
+	FileMode os.FileMode
+
+	// Changelog enables appending all the changes to a persistent changelog, which can be read with ReadChanges.
+	Changelog bool
+	// ChangelogRetention limits the number of changes kept in the changelog, zero means no limit.
+	ChangelogRetention int
+
+	// Observer receives the duration and outcome of every public operation, and the statistics of the database.
+	Observer Observer
+	// StatsInterval is how often the database statistics are sent to the Observer, by default every 10 seconds.
+	StatsInterval time.Duration
 }
 
 var defaultLogFn = func(string, ...interface{}) {}
@@ -47,11 +120,46 @@ func New(c Config) (*repo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = checkCodecTag(c.Codec); err != nil {
+		return nil, err
+	}
 	b := repo{
 		root:  []byte(rootBucket),
 		path:  p,
 		logFn: defaultLogFn,
 		errFn: defaultLogFn,
+
+		deleteMode:            c.DeleteMode,
+		deleteFromCollections: c.DeleteFromCollections,
+		keepHistory:           c.KeepHistory,
+		maxRevisions:          c.MaxRevisions,
+		codec:                 c.Codec,
+		compression:           c.Compression,
+		dictionary:            c.CompressionDictionary,
+		keys:                  c.KeyProvider,
+
+		fileMode: 0600,
+		options:  *bolt.DefaultOptions,
+
+		changelog:          c.Changelog,
+		changelogRetention: c.ChangelogRetention,
+
+		observer:      c.Observer,
+		statsInterval: c.StatsInterval,
+	}
+	if c.FileMode != 0 {
+		b.fileMode = c.FileMode
+	}
+	b.options.Timeout = c.Timeout
+	b.options.ReadOnly = c.ReadOnly
+	b.options.NoSync = c.NoSync
+	b.options.NoFreelistSync = c.NoFreelistSync
+	b.options.InitialMmapSize = c.InitialMmapSize
+	if b.keys == nil && len(c.EncryptionKey) > 0 {
+		if _, err = newAEAD(c.EncryptionKey); err != nil {
+			return nil, err
+		}
+		b.keys = StaticKey(c.EncryptionKey)
 	}
 	if c.ErrFn != nil {
 		b.errFn = c.ErrFn
@@ -59,15 +167,19 @@ func New(c Config) (*repo, error) {
 	if c.LogFn != nil {
 		b.logFn = c.LogFn
 	}
+	b.logger = c.Logger
+	if b.logger == nil {
+		b.logger = slog.New(newFnHandler(b.logFn, b.errFn))
+	}
 	return &b, nil
 }
 
-func loadRawItemFromBucket(b *bolt.Bucket) (vocab.Item, error) {
+func (r *repo) loadRawItemFromBucket(b *bolt.Bucket) (vocab.Item, error) {
 	raw := b.Get([]byte(objectKey))
 	if raw == nil {
 		return nil, errors.NotFoundf("not found")
 	}
-	it, err := decodeItemFn(raw)
+	it, err := r.decodeItem(raw)
 	if err != nil {
 		return nil, err
 	}
@@ -77,16 +189,21 @@ func loadRawItemFromBucket(b *bolt.Bucket) (vocab.Item, error) {
 	return it, nil
 }
 
-func (r *repo) loadItem(tx *bolt.Tx, b *bolt.Bucket, matcherFn func([]byte) bool, ff ...filters.Check) (vocab.Item, error) {
+func (r *repo) loadItem(ctx context.Context, tx *bolt.Tx, b *bolt.Bucket, matcherFn func([]byte) bool, ff ...filters.Check) (vocab.Item, error) {
 	// we have found an item
 	raw := b.Get([]byte(objectKey))
 	if raw == nil {
 		return nil, errors.NotFoundf("not found")
 	}
-	if matcherFn != nil && !matcherFn(raw) {
+	// NOTE: the value is decompressed once, for both the matcher and the decoder
+	c, data, err := r.codecFor(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !matchesRaw(matcherFn, c, data) {
 		return nil, errors.NotFoundf("not found")
 	}
-	it, err := decodeItemFn(raw)
+	it, err := c.DecodeItem(data)
 	if err != nil {
 		return nil, err
 	}
@@ -98,34 +215,34 @@ func (r *repo) loadItem(tx *bolt.Tx, b *bolt.Bucket, matcherFn func([]byte) bool
 		return it, nil
 	}
 	if vocab.IsIRI(it) {
-		if it, _ = r.loadOneFromBucket(tx, it.GetLink()); vocab.IsNil(it) {
+		if it, _ = r.loadOneFromBucket(ctx, tx, it.GetLink()); vocab.IsNil(it) {
 			return nil, errors.NotFoundf("not found")
 		}
 	}
 	if typ := it.GetType(); typ != nil {
 		if vocab.ActorTypes.Match(typ) {
-			_ = vocab.OnActor(it, loadFilteredPropsForActor(r, tx, ff...))
+			_ = vocab.OnActor(it, loadFilteredPropsForActor(ctx, r, tx, ff...))
 		}
 		if vocab.ObjectTypes.Match(typ) {
-			_ = vocab.OnObject(it, loadFilteredPropsForObject(r, tx, ff...))
+			_ = vocab.OnObject(it, loadFilteredPropsForObject(ctx, r, tx, ff...))
 		}
 		if vocab.IntransitiveActivityTypes.Match(typ) {
-			_ = vocab.OnIntransitiveActivity(it, loadFilteredPropsForIntransitiveActivity(r, tx, ff...))
+			_ = vocab.OnIntransitiveActivity(it, loadFilteredPropsForIntransitiveActivity(ctx, r, tx, ff...))
 		}
 		if vocab.ActivityTypes.Match(typ) {
-			_ = vocab.OnActivity(it, loadFilteredPropsForActivity(r, tx, ff...))
+			_ = vocab.OnActivity(it, loadFilteredPropsForActivity(ctx, r, tx, ff...))
 		}
 	}
 	return it, nil
 }
 
-func loadFilteredPropsForActor(r *repo, tx *bolt.Tx, ff ...filters.Check) func(a *vocab.Actor) error {
+func loadFilteredPropsForActor(ctx context.Context, r *repo, tx *bolt.Tx, ff ...filters.Check) func(a *vocab.Actor) error {
 	return func(a *vocab.Actor) error {
-		return vocab.OnObject(a, loadFilteredPropsForObject(r, tx, ff...))
+		return vocab.OnObject(a, loadFilteredPropsForObject(ctx, r, tx, ff...))
 	}
 }
 
-func loadFilteredPropsForObject(r *repo, tx *bolt.Tx, ff ...filters.Check) func(o *vocab.Object) error {
+func loadFilteredPropsForObject(ctx context.Context, r *repo, tx *bolt.Tx, ff ...filters.Check) func(o *vocab.Object) error {
 	return func(o *vocab.Object) error {
 		if len(o.Tag) == 0 {
 			return nil
@@ -135,7 +252,7 @@ func loadFilteredPropsForObject(r *repo, tx *bolt.Tx, ff ...filters.Check) func(
 				if vocab.IsNil(t) || !vocab.IsIRI(t) {
 					return nil
 				}
-				if ob, err := r.loadOneFromBucket(tx, t.GetLink()); err == nil {
+				if ob, err := r.loadOneFromBucket(ctx, tx, t.GetLink()); err == nil {
 					(*col)[i] = ob
 				}
 			}
@@ -144,26 +261,26 @@ func loadFilteredPropsForObject(r *repo, tx *bolt.Tx, ff ...filters.Check) func(
 	}
 }
 
-func loadFilteredPropsForActivity(r *repo, tx *bolt.Tx, ff ...filters.Check) func(a *vocab.Activity) error {
+func loadFilteredPropsForActivity(ctx context.Context, r *repo, tx *bolt.Tx, ff ...filters.Check) func(a *vocab.Activity) error {
 	return func(a *vocab.Activity) error {
 		if !vocab.IsNil(a.Object) && vocab.IsIRI(a.Object) {
-			if ob, err := r.loadOneFromBucket(tx, a.Object.GetLink()); err == nil {
+			if ob, err := r.loadOneFromBucket(ctx, tx, a.Object.GetLink()); err == nil {
 				a.Object = ob
 			}
 		}
-		return vocab.OnIntransitiveActivity(a, loadFilteredPropsForIntransitiveActivity(r, tx, ff...))
+		return vocab.OnIntransitiveActivity(a, loadFilteredPropsForIntransitiveActivity(ctx, r, tx, ff...))
 	}
 }
 
-func loadFilteredPropsForIntransitiveActivity(r *repo, tx *bolt.Tx, ff ...filters.Check) func(a *vocab.IntransitiveActivity) error {
+func loadFilteredPropsForIntransitiveActivity(ctx context.Context, r *repo, tx *bolt.Tx, ff ...filters.Check) func(a *vocab.IntransitiveActivity) error {
 	return func(a *vocab.IntransitiveActivity) error {
 		if !vocab.IsNil(a.Actor) && vocab.IsIRI(a.Actor) && len(filters.ActorChecks(ff...)) > 0 {
-			if act, err := r.loadOneFromBucket(tx, a.Actor.GetLink()); err == nil {
+			if act, err := r.loadOneFromBucket(ctx, tx, a.Actor.GetLink()); err == nil {
 				a.Actor = act
 			}
 		}
 		if !vocab.IsNil(a.Target) && vocab.IsIRI(a.Target) && len(filters.TargetChecks(ff...)) > 0 {
-			if t, err := r.loadOneFromBucket(tx, a.Target.GetLink()); err == nil {
+			if t, err := r.loadOneFromBucket(ctx, tx, a.Target.GetLink()); err == nil {
 				a.Target = t
 			}
 		}
@@ -171,33 +288,40 @@ func loadFilteredPropsForIntransitiveActivity(r *repo, tx *bolt.Tx, ff ...filter
 	}
 }
 
-func (r *repo) loadItemsElementsTx(tx *bolt.Tx, iris []vocab.Item, ff ...filters.Check) (vocab.ItemCollection, error) {
+func (r *repo) loadItemsElementsTx(ctx context.Context, tx *bolt.Tx, iris []vocab.Item, ff ...filters.Check) (vocab.ItemCollection, error) {
 	// TODO(marius): make this accept the bolt.TX directly
 	col := make(vocab.ItemCollection, 0)
 	rb := tx.Bucket(r.root)
 	if rb == nil {
 		return nil, ErrorInvalidRoot(r.root)
 	}
-	var err error
 	matcherFn := filters.RawMatcher(ff)
 	for _, iri := range iris {
-		var b *bolt.Bucket
-		remainderPath := itemBucketPath(iri.GetLink())
-		b, remainderPath, err = descendInBucket(rb, remainderPath, false)
-		if err != nil || b == nil {
-			continue
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		it, err := r.loadItem(tx, b, matcherFn)
+		it, err := r.loadItemElementTx(ctx, tx, rb, iri.GetLink(), matcherFn)
 		if err != nil || vocab.IsNil(it) {
 			continue
 		}
 		col = append(col, it)
 	}
-	return col, err
+	return col, nil
 }
 
-func (r *repo) loadOneFromBucket(tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check) (vocab.Item, error) {
-	col, err := r.loadFromBucket(tx, iri, ff...)
+func (r *repo) loadItemElementTx(ctx context.Context, tx *bolt.Tx, rb *bolt.Bucket, iri vocab.IRI, matcherFn func([]byte) bool, ff ...filters.Check) (vocab.Item, error) {
+	b, _, err := descendInBucket(rb, itemBucketPath(iri), false)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, errors.NotFoundf("not found")
+	}
+	return r.loadItem(ctx, tx, b, matcherFn, ff...)
+}
+
+func (r *repo) loadOneFromBucket(ctx context.Context, tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check) (vocab.Item, error) {
+	col, err := r.loadFromBucket(ctx, tx, iri, ff...)
 	if err != nil {
 		return nil, err
 	}
@@ -219,11 +343,11 @@ func (r *repo) loadOneFromBucket(tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check
 var orderedCollectionTypes = vocab.ActivityVocabularyTypes{vocab.OrderedCollectionPageType, vocab.OrderedCollectionType}
 var collectionTypes = vocab.ActivityVocabularyTypes{vocab.CollectionPageType, vocab.CollectionType}
 
-func (r *repo) iterateInBucket(tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, ff ...filters.Check) (vocab.Item, uint, error) {
+func (r *repo) iterateInBucket(ctx context.Context, tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, ff ...filters.Check) (vocab.Item, uint, error) {
 	if b == nil {
 		return nil, 0, errors.Errorf("invalid bucket to load from")
 	}
-	col, err := loadRawItemFromBucket(b)
+	col, err := r.loadRawItemFromBucket(b)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -238,6 +362,12 @@ func (r *repo) iterateInBucket(tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, ff ..
 	items := make(vocab.ItemCollection, 0)
 	// if no path was returned from descendIntoBucket we iterate over all keys in the current bucket
 	for key, _ := c.First(); key != nil; key, _ = c.Next() {
+		if err = ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		if string(key) == itemsBucket || string(key) == membersBucket || string(key) == historyBucket {
+			continue
+		}
 		ob := b
 		// TODO(marius): we need to see if we can avoid iterating in a bucket for both the UUID, and the underlying
 		//  __raw object, because currently they both get loaded and we need to use col.Contains to avoid duplication
@@ -247,7 +377,7 @@ func (r *repo) iterateInBucket(tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, ff ..
 				continue
 			}
 		}
-		it, err := loadRawItemFromBucket(ob)
+		it, err := r.loadRawItemFromBucket(ob)
 		if err != nil {
 			continue
 		}
@@ -255,8 +385,8 @@ func (r *repo) iterateInBucket(tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, ff ..
 			continue
 		}
 		if vocab.IsCollection(it) {
-			_ = vocab.OnCollectionIntf(it, func(c vocab.CollectionInterface) error {
-				itCol, err := r.loadItemsElementsTx(tx, c.Collection(), ff...)
+			err = vocab.OnCollectionIntf(it, func(_ vocab.CollectionInterface) error {
+				itCol, err := r.loadItemsElementsTx(ctx, tx, collectionMembers(ob), ff...)
 				if err != nil {
 					return err
 				}
@@ -265,6 +395,9 @@ func (r *repo) iterateInBucket(tx *bolt.Tx, b *bolt.Bucket, iri vocab.IRI, ff ..
 				}
 				return nil
 			})
+			if err != nil && ctx.Err() != nil {
+				return nil, 0, err
+			}
 		} else {
 			_ = items.Append(it)
 		}
@@ -282,7 +415,10 @@ var ErrorInvalidRoot = func(b []byte) error {
 	return errors.NotFoundf("Invalid root bucket %s", b)
 }
 
-func (r *repo) loadFromBucket(tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check) (vocab.Item, error) {
+func (r *repo) loadFromBucket(ctx context.Context, tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check) (vocab.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var it vocab.Item
 	rb := tx.Bucket(r.root)
 	if rb == nil {
@@ -309,7 +445,14 @@ func (r *repo) loadFromBucket(tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check) (
 
 	// NOTE(marius): loading items from collection
 	if isStorageCollectionKey(string(fullPath)) {
-		fromBucket, _, err := r.iterateInBucket(tx, b, iri, ff...)
+		cur, rest := paginationFromChecks(ff...)
+		if cur.isSet() {
+			return r.loadCollectionPage(ctx, tx, b, iri, cur, rest...)
+		}
+		if col, ok, err := r.loadIndexedCollection(ctx, tx, b, iri, rest...); ok || err != nil {
+			return col, err
+		}
+		fromBucket, _, err := r.iterateInBucket(ctx, tx, b, iri, ff...)
 		if err != nil {
 			return nil, err
 		}
@@ -322,13 +465,13 @@ func (r *repo) loadFromBucket(tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check) (
 	}
 	if len(remainderPath) == 0 {
 		// we have found an item
-		it, err = r.loadItem(tx, b, nil)
+		it, err = r.loadItem(ctx, tx, b, nil)
 		if err != nil {
 			return nil, err
 		}
 		if vocab.IsCollection(it) {
-			return it, vocab.OnCollectionIntf(it, func(c vocab.CollectionInterface) error {
-				it, err = r.loadItemsElementsTx(tx, c.Collection(), ff...)
+			return it, vocab.OnCollectionIntf(it, func(_ vocab.CollectionInterface) error {
+				it, err = r.loadItemsElementsTx(ctx, tx, collectionMembers(b), ff...)
 				return err
 			})
 		}
@@ -339,19 +482,66 @@ func (r *repo) loadFromBucket(tx *bolt.Tx, iri vocab.IRI, ff ...filters.Check) (
 
 // Load
 func (r *repo) Load(i vocab.IRI, fil ...filters.Check) (vocab.Item, error) {
+	return r.LoadCtx(context.Background(), i, fil...)
+}
+
+// LoadCtx is Load, which stops iterating the collections, and dereferencing the items, when ctx is done.
+func (r *repo) LoadCtx(ctx context.Context, i vocab.IRI, fil ...filters.Check) (ret vocab.Item, err error) {
+	defer r.observe(ctx, "Load", i, time.Now(), func() (int, error) { return itemCount(ret), err })
+
+	if r == nil || r.d == nil {
+		return nil, errNotOpen
+	}
+	err = r.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		ret, err = r.loadTx(ctx, tx, i, fil...)
+		return err
+	})
+	return ret, err
+}
+
+// Children returns the IRIs of the objects and collections stored directly under iri.
+// An empty iri lists the hosts which have objects stored.
+func (r *repo) Children(iri vocab.IRI) (vocab.IRIs, error) {
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
-	var ret vocab.Item
+	children := make(vocab.IRIs, 0)
 	err := r.d.View(func(tx *bolt.Tx) error {
-		ob, err := r.loadFromBucket(tx, i, fil...)
-		if err != nil {
-			return err
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return ErrorInvalidRoot(r.root)
 		}
-		ret = ob
-		return nil
+		path := itemBucketPath(iri)
+		b, remainder, err := descendInBucket(root, path, false)
+		if err != nil || len(remainder) > 0 {
+			return errors.NotFoundf("%s not found", iri)
+		}
+		prefix := strings.TrimRight(string(iri), "/") + "/"
+		if len(path) == 0 {
+			prefix = "https://"
+		}
+		return b.ForEachBucket(func(k []byte) error {
+			if isReservedKey(k) || (len(path) == 0 && isRootReservedKey(k)) {
+				return nil
+			}
+			children = append(children, vocab.IRI(prefix+string(k)))
+			return nil
+		})
 	})
-	return filters.Checks(fil).Run(ret), err
+	return children, err
+}
+
+func (r *repo) loadTx(ctx context.Context, tx *bolt.Tx, i vocab.IRI, fil ...filters.Check) (vocab.Item, error) {
+	ret, err := r.loadFromBucket(ctx, tx, i, fil...)
+	if err != nil {
+		return nil, err
+	}
+	if isPaginatedLoad(i, fil...) {
+		// NOTE: the collection page has already been filtered and paginated while iterating the bucket
+		return ret, nil
+	}
+	return filters.Checks(fil).Run(ret), nil
 }
 
 var pathSeparator = []byte{'/'}
@@ -428,20 +618,23 @@ func descendInBucket(root *bolt.Bucket, path []byte, create bool) (*bolt.Bucket,
 const objectKey = "__raw"
 const metaDataKey = "__meta_data"
 
-func delete(r *repo, it vocab.Item) error {
+func delete(ctx context.Context, r *repo, tx *bolt.Tx, it vocab.Item) error {
 	if vocab.IsCollection(it) {
 		return vocab.OnCollectionIntf(it, func(c vocab.CollectionInterface) error {
 			var err error
 			for _, it := range c.Collection() {
-				if err = deleteItem(r, it); err != nil {
-					r.logFn("Unable to remove item %s", it.GetLink())
+				if err = ctx.Err(); err != nil {
+					return err
+				}
+				if err = deleteItem(r, tx, it); err != nil {
+					r.log().Warn("Unable to remove item", "op", "Delete", "iri", it.GetLink(), "err", err)
 				}
 			}
 			return nil
 		})
 	}
 
-	return deleteItem(r, it.GetLink())
+	return deleteItem(r, tx, it.GetLink())
 }
 
 func itemBucketPath(iri vocab.IRI) []byte {
@@ -452,7 +645,7 @@ func itemBucketPath(iri vocab.IRI) []byte {
 	return []byte(url.Host + url.Path)
 }
 
-func createCollection(b *bolt.Bucket, colIRI vocab.IRI, owner vocab.Item) (vocab.CollectionInterface, error) {
+func (r *repo) createCollection(b *bolt.Bucket, colIRI vocab.IRI, owner vocab.Item) (vocab.CollectionInterface, error) {
 	col := vocab.OrderedCollection{
 		ID:        colIRI,
 		Type:      vocab.OrderedCollectionType,
@@ -469,11 +662,11 @@ func createCollection(b *bolt.Bucket, colIRI vocab.IRI, owner vocab.Item) (vocab
 		})
 
 	}
-	return saveCollection(b, &col)
+	return r.saveCollection(b, &col)
 }
 
-func saveCollection(b *bolt.Bucket, col vocab.CollectionInterface) (vocab.CollectionInterface, error) {
-	if err := saveRawItem(col, b); err != nil {
+func (r *repo) saveCollection(b *bolt.Bucket, col vocab.CollectionInterface) (vocab.CollectionInterface, error) {
+	if err := r.saveRawItem(col, b); err != nil {
 		return nil, err
 	}
 
@@ -484,13 +677,13 @@ func saveCollection(b *bolt.Bucket, col vocab.CollectionInterface) (vocab.Collec
 	return col, err
 }
 
-func saveNewCollection(it vocab.Item, b *bolt.Bucket, owner vocab.Item) (vocab.Item, error) {
-	colObject, err := loadRawItemFromBucket(b)
+func (r *repo) saveNewCollection(it vocab.Item, b *bolt.Bucket, owner vocab.Item) (vocab.Item, error) {
+	colObject, err := r.loadRawItemFromBucket(b)
 	if err != nil && !errors.IsNotFound(err) {
 		return nil, err
 	}
 	if colObject == nil {
-		it, err = createCollection(b, it.GetLink(), owner)
+		it, err = r.createCollection(b, it.GetLink(), owner)
 		if err != nil {
 			return nil, err
 		}
@@ -498,7 +691,7 @@ func saveNewCollection(it vocab.Item, b *bolt.Bucket, owner vocab.Item) (vocab.I
 	return it.GetLink(), nil
 }
 
-func createCollectionInBucket(parent *bolt.Bucket, it vocab.Item, owner vocab.Item) (vocab.Item, error) {
+func (r *repo) createCollectionInBucket(parent *bolt.Bucket, it vocab.Item, owner vocab.Item) (vocab.Item, error) {
 	if vocab.IsNil(it) {
 		return nil, nil
 	}
@@ -509,10 +702,10 @@ func createCollectionInBucket(parent *bolt.Bucket, it vocab.Item, owner vocab.It
 		return nil, err
 	}
 
-	return saveNewCollection(it, b, owner)
+	return r.saveNewCollection(it, b, owner)
 }
 
-func createCollectionsInBucket(b *bolt.Bucket, it vocab.Item) error {
+func (r *repo) createCollectionsInBucket(b *bolt.Bucket, it vocab.Item) error {
 	if vocab.IsNil(it) || !vocab.IsObject(it) {
 		return nil
 	}
@@ -521,59 +714,76 @@ func createCollectionsInBucket(b *bolt.Bucket, it vocab.Item) error {
 	if vocab.ActorTypes.Match(typ) {
 		_ = vocab.OnActor(it, func(p *vocab.Actor) error {
 			if p.Inbox != nil {
-				p.Inbox, _ = createCollectionInBucket(b, vocab.Inbox.IRI(p), p)
+				p.Inbox, _ = r.createCollectionInBucket(b, vocab.Inbox.IRI(p), p)
 			}
 			if p.Outbox != nil {
-				p.Outbox, _ = createCollectionInBucket(b, vocab.Outbox.IRI(p), p)
+				p.Outbox, _ = r.createCollectionInBucket(b, vocab.Outbox.IRI(p), p)
 			}
 			if p.Followers != nil {
-				p.Followers, _ = createCollectionInBucket(b, vocab.Followers.IRI(p), p)
+				p.Followers, _ = r.createCollectionInBucket(b, vocab.Followers.IRI(p), p)
 			}
 			if p.Following != nil {
-				p.Following, _ = createCollectionInBucket(b, vocab.Following.IRI(p), p)
+				p.Following, _ = r.createCollectionInBucket(b, vocab.Following.IRI(p), p)
 			}
 			if p.Liked != nil {
-				p.Liked, _ = createCollectionInBucket(b, vocab.Liked.IRI(p), p)
+				p.Liked, _ = r.createCollectionInBucket(b, vocab.Liked.IRI(p), p)
 			}
 			return nil
 		})
 	}
 	return vocab.OnObject(it, func(o *vocab.Object) error {
 		if o.Replies != nil {
-			o.Replies, _ = createCollectionInBucket(b, vocab.Replies.IRI(o), o)
+			o.Replies, _ = r.createCollectionInBucket(b, vocab.Replies.IRI(o), o)
 		}
 		if o.Likes != nil {
-			o.Likes, _ = createCollectionInBucket(b, vocab.Likes.IRI(o), o)
+			o.Likes, _ = r.createCollectionInBucket(b, vocab.Likes.IRI(o), o)
 		}
 		if o.Shares != nil {
-			o.Shares, _ = createCollectionInBucket(b, vocab.Shares.IRI(o), o)
+			o.Shares, _ = r.createCollectionInBucket(b, vocab.Shares.IRI(o), o)
 		}
 		return nil
 	})
 }
 
 // deleteItem
-func deleteItem(r *repo, it vocab.Item) error {
+func deleteItem(r *repo, tx *bolt.Tx, it vocab.Item) error {
 	pathInBucket := itemBucketPath(it.GetLink())
-	return r.d.Update(func(tx *bolt.Tx) error {
-		root := tx.Bucket(r.root)
-		if root == nil {
-			return ErrorInvalidRoot(r.root)
+	root := tx.Bucket(r.root)
+	if root == nil {
+		return ErrorInvalidRoot(r.root)
+	}
+	if !root.Writable() {
+		return errors.Errorf("Non writeable bucket %s", r.root)
+	}
+	if r.deleteFromCollections {
+		if err := r.removeFromAllCollections(root, it.GetLink()); err != nil {
+			return errors.Annotatef(err, "Unable to remove %s from its collections", it.GetLink())
 		}
-		if !root.Writable() {
-			return errors.Errorf("Non writeable bucket %s", r.root)
+	}
+	if err := r.logChange(root, Change{Op: OpDelete, IRI: it.GetLink()}); err != nil {
+		return err
+	}
+	r.emit(tx, Event{Op: OpDelete, IRI: it.GetLink()})
+	if r.deleteMode == DeleteTombstone {
+		if ok, err := r.tombstoneInBucket(root, pathInBucket); ok || err != nil {
+			return err
+		}
+	}
+	if b, remainder, err := descendInBucket(root, pathInBucket, false); err == nil && len(remainder) == 0 {
+		if err = r.unindexBucketTree(root, b); err != nil {
+			return errors.Annotatef(err, "Unable to remove %s from indexes", it.GetLink())
 		}
+	}
 
-		return deleteLastBucketFromRoot(root, pathInBucket)
-	})
+	return deleteLastBucketFromRoot(root, pathInBucket)
 }
 
-func saveRawItem(it vocab.Item, b *bolt.Bucket) error {
+func (r *repo) saveRawItem(it vocab.Item, b *bolt.Bucket) error {
 	if !b.Writable() {
 		return errors.Errorf("Non writeable bucket")
 	}
 
-	entryBytes, err := encodeItemFn(it)
+	entryBytes, err := r.encodeItem(it)
 	if err != nil {
 		return errors.Annotatef(err, "could not marshal object")
 	}
@@ -586,7 +796,7 @@ func saveRawItem(it vocab.Item, b *bolt.Bucket) error {
 }
 
 func rootFromTx(tx *bolt.Tx, path []byte) (*bolt.Bucket, error) {
-	root, err := tx.CreateBucketIfNotExists(path)
+	root, err := createRootBucket(tx, path)
 	if err != nil {
 		return root, errors.Errorf("Not able to write to root bucket %s", path)
 	}
@@ -599,49 +809,77 @@ func rootFromTx(tx *bolt.Tx, path []byte) (*bolt.Bucket, error) {
 	return root, nil
 }
 
-func save(r *repo, it vocab.Item) (vocab.Item, error) {
-	pathInBucket := itemBucketPath(it.GetLink())
-	err := r.d.Update(func(tx *bolt.Tx) error {
-		root, err := rootFromTx(tx, r.root)
-		if err != nil {
-			return errors.Annotatef(err, "Unable to load root bucket")
-		}
-		b, uuid, err := descendInBucket(root, pathInBucket, true)
-		if err != nil {
-			return errors.Annotatef(err, "Unable to find %s in root bucket", pathInBucket)
-		}
-		if !b.Writable() {
-			return errors.Errorf("Non writeable bucket %s", pathInBucket)
-		}
-		if len(uuid) == 0 {
-			if err := createCollectionsInBucket(b, it); err != nil {
-				return errors.Annotatef(err, "could not create object's collections")
-			}
-		}
-
-		return saveRawItem(it, b)
+func save(ctx context.Context, r *repo, it vocab.Item) (vocab.Item, error) {
+	err := r.updateCtx(ctx, func(tx *bolt.Tx) error {
+		return saveTx(r, tx, it)
 	})
 
 	return it, err
 }
 
+func saveTx(r *repo, tx *bolt.Tx, it vocab.Item) error {
+	pathInBucket := itemBucketPath(it.GetLink())
+	root, err := rootFromTx(tx, r.root)
+	if err != nil {
+		return errors.Annotatef(err, "Unable to load root bucket")
+	}
+	b, uuid, err := descendInBucket(root, pathInBucket, true)
+	if err != nil {
+		return errors.Annotatef(err, "Unable to find %s in root bucket", pathInBucket)
+	}
+	if !b.Writable() {
+		return errors.Errorf("Non writeable bucket %s", pathInBucket)
+	}
+	if len(uuid) == 0 {
+		if err := r.createCollectionsInBucket(b, it); err != nil {
+			return errors.Annotatef(err, "could not create object's collections")
+		}
+	}
+	if err = indexItem(root, it); err != nil {
+		return errors.Annotatef(err, "could not index %s", it.GetLink())
+	}
+	if !vocab.IsCollection(it) {
+		if err = r.saveRevision(b, it); err != nil {
+			return errors.Annotatef(err, "could not save previous version of %s", it.GetLink())
+		}
+		err = r.saveRawItem(it, b)
+	} else {
+		err = r.saveCollectionHeader(root, b, it)
+	}
+	if err != nil {
+		return err
+	}
+	if err = r.logChange(root, Change{Op: OpSave, IRI: it.GetLink()}); err != nil {
+		return err
+	}
+	r.emit(tx, Event{Op: OpSave, IRI: it.GetLink()})
+	return nil
+}
+
 var errNotOpen = errors.Newf("repository not open")
 
 // Save
 func (r *repo) Save(it vocab.Item) (vocab.Item, error) {
+	return r.SaveCtx(context.Background(), it)
+}
+
+// SaveCtx is Save, which doesn't commit the changes if ctx is done before they're finished.
+func (r *repo) SaveCtx(ctx context.Context, it vocab.Item) (_ vocab.Item, err error) {
+	defer r.observe(ctx, "Save", linkOf(it), time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return nil, errNotOpen
 	}
 	if vocab.IsNil(it) {
 		return nil, errors.Newf("Unable to save nil element")
 	}
-	it, err := save(r, it)
+	it, err = save(ctx, r, it)
 	if err == nil {
-		op := "Updated"
+		msg := "Updated"
 		if id := it.GetID(); !id.IsValid() {
-			op = "Added new"
+			msg = "Added new"
 		}
-		r.logFn("%s %s", op, it.GetLink())
+		r.log().InfoContext(ctx, msg, "op", "Save", "iri", it.GetLink())
 	}
 
 	return it, err
@@ -649,47 +887,75 @@ func (r *repo) Save(it vocab.Item) (vocab.Item, error) {
 
 // RemoveFrom
 func (r *repo) RemoveFrom(colIRI vocab.IRI, items ...vocab.Item) error {
+	return r.RemoveFromCtx(context.Background(), colIRI, items...)
+}
+
+// RemoveFromCtx is RemoveFrom, which doesn't commit the changes if ctx is done before they're finished.
+func (r *repo) RemoveFromCtx(ctx context.Context, colIRI vocab.IRI, items ...vocab.Item) (err error) {
+	defer r.observe(ctx, "RemoveFrom", colIRI, time.Now(), func() (int, error) { return len(items), err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
+	if err = r.updateCtx(ctx, func(tx *bolt.Tx) error {
+		return r.removeFromTx(ctx, tx, colIRI, items...)
+	}); err != nil {
+		return err
+	}
+	for _, it := range items {
+		r.log().DebugContext(ctx, "Removed from collection", "op", "RemoveFrom", "iri", linkOf(it), "collection", colIRI)
+	}
+	return nil
+}
+
+func (r *repo) removeFromTx(ctx context.Context, tx *bolt.Tx, colIRI vocab.IRI, items ...vocab.Item) error {
 	pathInBucket := itemBucketPath(colIRI.GetLink())
-	return r.d.Update(func(tx *bolt.Tx) error {
-		root, err := rootFromTx(tx, r.root)
-		if err != nil {
-			return errors.Annotatef(err, "Unable to load root bucket")
-		}
-		b, _, err := descendInBucket(root, pathInBucket, true)
+	root, err := rootFromTx(tx, r.root)
+	if err != nil {
+		return errors.Annotatef(err, "Unable to load root bucket")
+	}
+	b, _, err := descendInBucket(root, pathInBucket, true)
+	if err != nil {
+		return errors.Annotatef(err, "Unable to find %s in root bucket", pathInBucket)
+	}
+	if !b.Writable() {
+		return errors.Errorf("Non writeable bucket %s", pathInBucket)
+	}
+	col, err := r.loadRawItemFromBucket(b)
+	if err != nil {
+		return err
+	}
+	if col == nil {
+		col, err = r.createCollection(b, colIRI, nil)
 		if err != nil {
-			return errors.Annotatef(err, "Unable to find %s in root bucket", pathInBucket)
+			return err
 		}
-		if !b.Writable() {
-			return errors.Errorf("Non writeable bucket %s", pathInBucket)
+	}
+
+	removed := uint(0)
+	for _, it := range items {
+		if err = ctx.Err(); err != nil {
+			return err
 		}
-		col, err := loadRawItemFromBucket(b)
+		ok, err := removeFromCollectionBucket(b, it.GetLink())
 		if err != nil {
 			return err
 		}
-		if col == nil {
-			col, err = createCollection(b, colIRI, nil)
-			if err != nil {
+		if ok {
+			removed++
+			if err = r.logChange(root, Change{Op: OpRemoveFrom, IRI: it.GetLink(), Collection: colIRI}); err != nil {
 				return err
 			}
+			r.emit(tx, Event{Op: OpRemoveFrom, IRI: it.GetLink(), Collection: colIRI})
 		}
-
-		err = vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
-			c.OrderedItems.Remove(items...)
-			if c.TotalItems <= uint(len(items)) {
-				c.TotalItems = 0
-			} else {
-				c.TotalItems -= uint(len(items))
-			}
-			return nil
-		})
-		if err != nil {
+		if err = removeMembership(root, colIRI, it.GetLink()); err != nil {
 			return err
 		}
-		return saveRawItem(col, b)
-	})
+	}
+	if err = decrementTotal(col, removed); err != nil {
+		return err
+	}
+	return r.saveRawItem(col, b)
 }
 
 func buildCollection(items vocab.ItemCollection) vocab.WithCollectionFn {
@@ -722,71 +988,194 @@ func isHiddenCollectionKey(p string) bool {
 
 // AddTo
 func (r *repo) AddTo(colIRI vocab.IRI, items ...vocab.Item) error {
+	return r.AddToCtx(context.Background(), colIRI, items...)
+}
+
+// AddToCtx is AddTo, which doesn't commit the changes if ctx is done before they're finished.
+func (r *repo) AddToCtx(ctx context.Context, colIRI vocab.IRI, items ...vocab.Item) error {
+	_, err := r.addTo(ctx, "AddTo", colIRI, items...)
+	return err
+}
+
+// AddToCollection adds the items to the colIRI collection, skipping the ones that are already members.
+// It returns the items that have been added.
+func (r *repo) AddToCollection(colIRI vocab.IRI, items ...vocab.Item) (vocab.ItemCollection, error) {
+	return r.AddToCollectionCtx(context.Background(), colIRI, items...)
+}
+
+// AddToCollectionCtx is AddToCollection, which doesn't commit the changes if ctx is done before they're finished.
+func (r *repo) AddToCollectionCtx(ctx context.Context, colIRI vocab.IRI, items ...vocab.Item) (vocab.ItemCollection, error) {
+	return r.addTo(ctx, "AddToCollection", colIRI, items...)
+}
+
+func (r *repo) addTo(ctx context.Context, op string, colIRI vocab.IRI, items ...vocab.Item) (added vocab.ItemCollection, err error) {
+	defer r.observe(ctx, op, colIRI, time.Now(), func() (int, error) { return len(added), err })
+
 	if r == nil || r.d == nil {
-		return errNotOpen
+		return nil, errNotOpen
 	}
 	if len(items) == 0 {
-		return nil
+		return nil, nil
 	}
 
+	err = r.updateCtx(ctx, func(tx *bolt.Tx) error {
+		var err error
+		added, err = r.addToTx(ctx, tx, colIRI, items...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range added {
+		r.log().DebugContext(ctx, "Added to collection", "op", op, "iri", it.GetLink(), "collection", colIRI)
+	}
+	return added, nil
+}
+
+func (r *repo) addToTx(ctx context.Context, tx *bolt.Tx, colIRI vocab.IRI, items ...vocab.Item) (vocab.ItemCollection, error) {
 	pathInBucket := itemBucketPath(colIRI)
-	return r.d.Update(func(tx *bolt.Tx) error {
-		root, err := rootFromTx(tx, r.root)
-		if err != nil {
-			return errors.Annotatef(err, "Unable to load root bucket")
+	root, err := rootFromTx(tx, r.root)
+	if err != nil {
+		return nil, errors.Annotatef(err, "Unable to load root bucket")
+	}
+	b, _, err := descendInBucket(root, pathInBucket, true)
+	if err != nil {
+		return nil, errors.Annotatef(err, "Unable to find %s in root bucket", pathInBucket)
+	}
+	if !b.Writable() {
+		return nil, errors.Errorf("Non writeable bucket %s", pathInBucket)
+	}
+	col, err := r.loadRawItemFromBucket(b)
+	if err != nil {
+		if errors.IsNotFound(err) && isHiddenCollectionKey(colIRI.String()) {
+			// NOTE(marius): for hidden collections we might not have the __raw file on disk, so we just try to create it
+			// Here we assume the owner can be inferred from the collection IRI, but that's just a FedBOX implementation
+			// detail. We should find a different way to pass collection owner - maybe the processing package checks for
+			// existence of the blocked collection, and explicitly creates it if it doesn't.
+			maybeOwner, _ := vocab.Split(colIRI)
+			if col, err = r.createCollection(b, colIRI, maybeOwner); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, err
 		}
-		b, _, err := descendInBucket(root, pathInBucket, true)
-		if err != nil {
-			return errors.Annotatef(err, "Unable to find %s in root bucket", pathInBucket)
+	}
+
+	added := make(vocab.ItemCollection, 0, len(items))
+	for _, it := range items {
+		if err = ctx.Err(); err != nil {
+			return nil, err
 		}
-		if !b.Writable() {
-			return errors.Errorf("Non writeable bucket %s", pathInBucket)
+		if vocab.IsNil(it) {
+			continue
 		}
-		col, err := loadRawItemFromBucket(b)
-		if err != nil {
-			if errors.IsNotFound(err) && isHiddenCollectionKey(colIRI.String()) {
-				// NOTE(marius): for hidden collections we might not have the __raw file on disk, so we just try to create it
-				// Here we assume the owner can be inferred from the collection IRI, but that's just a FedBOX implementation
-				// detail. We should find a different way to pass collection owner - maybe the processing package checks for
-				// existence of the blocked collection, and explicitly creates it if it doesn't.
-				maybeOwner, _ := vocab.Split(colIRI)
-				if col, err = createCollection(b, colIRI, maybeOwner); err != nil {
-					return err
-				}
-			} else {
-				return err
-			}
+		if memberKey(b, it.GetLink()) != nil {
+			// NOTE: redelivered activities are already members of the collection, so we skip them
+			continue
 		}
-
-		err = vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
-			for _, it := range items {
-				if vocab.IsIRI(it) {
-					it, err = r.loadOneFromBucket(tx, it.GetLink())
-					if err != nil {
-						return errors.NewNotFound(err, "invalid item to add to collection")
-					}
-				}
-				_ = c.OrderedItems.Append(it.GetLink())
-				c.TotalItems += 1
+		toAdd := it
+		if vocab.IsIRI(it) {
+			toAdd, err = r.loadOneFromBucket(ctx, tx, it.GetLink())
+			if err != nil {
+				return nil, errors.NewNotFound(err, "invalid item to add to collection")
 			}
-			return nil
-		})
+		}
+		ok, err := appendToCollectionBucket(b, toAdd.GetLink())
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if !ok {
+			continue
 		}
-		return saveRawItem(col, b)
+		if err = addMembership(root, colIRI, toAdd.GetLink()); err != nil {
+			return nil, errors.Annotatef(err, "could not index %s as member of %s", toAdd.GetLink(), colIRI)
+		}
+		if err = r.logChange(root, Change{Op: OpAddTo, IRI: toAdd.GetLink(), Collection: colIRI}); err != nil {
+			return nil, err
+		}
+		r.emit(tx, Event{Op: OpAddTo, IRI: toAdd.GetLink(), Collection: colIRI})
+		added = append(added, it)
+	}
+	if len(added) == 0 {
+		return added, nil
+	}
+	err = onCollectionHeader(col, func(_ *vocab.ItemCollection, total *uint) {
+		*total += uint(len(added))
 	})
+	if err != nil {
+		return nil, err
+	}
+	return added, r.saveRawItem(col, b)
 }
 
 // Delete
 func (r *repo) Delete(it vocab.Item) error {
+	return r.DeleteCtx(context.Background(), it)
+}
+
+// DeleteCtx is Delete, which doesn't commit the changes if ctx is done before they're finished.
+func (r *repo) DeleteCtx(ctx context.Context, it vocab.Item) (err error) {
+	defer r.observe(ctx, "Delete", linkOf(it), time.Now(), func() (int, error) { return 1, err })
+
 	if r == nil || r.d == nil {
 		return errNotOpen
 	}
 	if vocab.IsNil(it) {
 		return nil
 	}
-	return delete(r, it)
+	if err = r.updateCtx(ctx, func(tx *bolt.Tx) error {
+		return delete(ctx, r, tx, it)
+	}); err != nil {
+		return err
+	}
+	r.log().DebugContext(ctx, "Deleted", "op", "Delete", "iri", it.GetLink())
+	return nil
+}
+
+// ErrorReadOnly is returned by the methods writing to a repository opened in read-only mode.
+var ErrorReadOnly = errors.MethodNotAllowedf("repository is read-only")
+
+// openDB opens the boltdb database file using the options from the repository's Config.
+func (r *repo) openDB() (*bolt.DB, error) {
+	mode := r.fileMode
+	if mode == 0 {
+		mode = 0600
+	}
+	return bolt.Open(r.path, mode, &r.options)
+}
+
+// update runs fn in a read-write transaction, failing with ErrorReadOnly for read-only repositories.
+func (r *repo) update(fn func(tx *bolt.Tx) error) error {
+	if r.d.IsReadOnly() {
+		return ErrorReadOnly
+	}
+	return r.d.Update(fn)
+}
+
+// updateCtx is update, which rolls back the transaction, returning ctx.Err(), if ctx is done before fn finishes.
+// NOTE: the context is checked again after the transaction starts, as it can wait for the write lock
+// held by other transactions.
+func (r *repo) updateCtx(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.update(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+}
+
+// view runs fn in a read-only transaction, if ctx is not done.
+func (r *repo) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.d.View(fn)
 }
 
 // Open opens the boltdb database if possible.
@@ -797,23 +1186,40 @@ func (r *repo) Open() error {
 	if r.d != nil {
 		return nil
 	}
-	db, err := bolt.Open(r.path, 0600, nil)
-	if err == nil {
-		r.d = db
+	db, err := r.openDB()
+	if err != nil {
+		return err
 	}
-	return err
+	if err = checkSchemaVersion(db, r.root); err != nil {
+		_ = db.Close()
+		return err
+	}
+	if err = r.startChangelog(db); err != nil {
+		_ = db.Close()
+		return err
+	}
+	r.d = db
+	if r.observer != nil {
+		r.stopStats = r.watchStats(db)
+	}
+	return nil
 }
 
 func (r *repo) close() error {
 	if r == nil {
 		return errors.Newf("Unable to close uninitialized db")
 	}
+	if r.stopStats != nil {
+		r.stopStats()
+		r.stopStats = nil
+	}
 	if r.d != nil {
 		if err := r.d.Close(); err != nil {
-			r.errFn("error closing the boltdb: %+s", err)
+			r.log().Error("Unable to close the boltdb", "err", err)
 		}
 		r.d = nil
 	}
+	r.events.closeAll()
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package boltdb
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/go-ap/errors"
 	"github.com/go-ap/filters"
 	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
 )
 
 func Test_New(t *testing.T) {
@@ -36,6 +38,9 @@ func Test_New(t *testing.T) {
 	if repo.logFn == nil {
 		t.Errorf("Nil log function, expected %T[%p]", t.Logf, t.Logf)
 	}
+	if repo.logger == nil {
+		t.Errorf("Nil structured logger, expected one wrapping the log functions")
+	}
 }
 
 func withCreatePath(t *testing.T, r *repo) *repo {
@@ -140,6 +145,95 @@ func TestRepo_Close(t *testing.T) {
 	os.Remove(path)
 }
 
+func Test_repo_Open_Timeout(t *testing.T) {
+	conf := Config{Path: t.TempDir()}
+	if err := Bootstrap(conf); err != nil {
+		t.Fatalf("Unable to bootstrap boltdb: %s", err)
+	}
+	locked, _ := New(conf)
+	if err := locked.Open(); err != nil {
+		t.Fatalf("Unable to open boltdb: %s", err)
+	}
+	t.Cleanup(locked.Close)
+
+	conf.Timeout = 50 * time.Millisecond
+	r, _ := New(conf)
+	if err := r.Open(); !errors.Is(err, bolt.ErrTimeout) {
+		t.Errorf("Open() of locked db error = %v, want %v", err, bolt.ErrTimeout)
+	}
+}
+
+func Test_repo_ReadOnly(t *testing.T) {
+	conf := Config{Path: t.TempDir()}
+	w := mockRepo(t, fields{path: conf.Path}, withOpenRoot, withBootstrap, withMockItems, withOrderedCollection("https://example.com/followers"))
+	w.Close()
+
+	conf.ReadOnly = true
+	r, _ := New(conf)
+	if err := r.Open(); err != nil {
+		t.Fatalf("Unable to open read-only boltdb: %s", err)
+	}
+	t.Cleanup(r.Close)
+
+	if _, err := r.Load("https://example.com/1"); err != nil {
+		t.Errorf("Load() from read-only repo error = %s", err)
+	}
+	ob := &vocab.Object{ID: "https://example.com/2", Type: vocab.NoteType}
+	if _, err := r.Save(ob); !errors.Is(err, ErrorReadOnly) {
+		t.Errorf("Save() error = %v, want %v", err, ErrorReadOnly)
+	}
+	if err := r.AddTo("https://example.com/followers", ob.ID); !errors.Is(err, ErrorReadOnly) {
+		t.Errorf("AddTo() error = %v, want %v", err, ErrorReadOnly)
+	}
+	if err := r.Delete(mockItems[1]); !errors.Is(err, ErrorReadOnly) {
+		t.Errorf("Delete() error = %v, want %v", err, ErrorReadOnly)
+	}
+	if err := r.SaveMetadata("https://example.com/~jdoe", Metadata{Pw: encPw}); !errors.Is(err, ErrorReadOnly) {
+		t.Errorf("SaveMetadata() error = %v, want %v", err, ErrorReadOnly)
+	}
+	if !errors.IsMethodNotAllowed(ErrorReadOnly) {
+		t.Errorf("ErrorReadOnly is not a method not allowed error")
+	}
+}
+
+func Test_repo_Children(t *testing.T) {
+	tests := []struct {
+		name    string
+		iri     vocab.IRI
+		want    vocab.IRIs
+		wantErr error
+	}{
+		{
+			name: "hosts",
+			want: vocab.IRIs{"https://example.com"},
+		},
+		{
+			name: "host",
+			iri:  "https://example.com",
+			want: vocab.IRIs{"https://example.com/1", "https://example.com/followers", "https://example.com/plain-iri", "https://example.com/~jdoe"},
+		},
+		{
+			name:    "missing",
+			iri:     "https://example.com/missing",
+			wantErr: errors.NotFoundf("https://example.com/missing not found"),
+		},
+	}
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems, withOrderedCollectionHavingItems)
+	t.Cleanup(r.Close)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Children(tt.iri)
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("Children() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+				return
+			}
+			if tt.wantErr == nil && !cmp.Equal(got, tt.want) {
+				t.Errorf("Children() = %s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
 func defaultCol(iri vocab.IRI) vocab.CollectionInterface {
 	return &vocab.OrderedCollection{
 		ID:        iri,
@@ -185,7 +279,7 @@ func withOrderedCollectionHavingItems(t *testing.T, r *repo) *repo {
 		t.Errorf("unable to save collection %s: %s", colIRI, err)
 	}
 	obIRI := vocab.IRI("https://example.com")
-	ob, err := save(r, vocab.Object{ID: obIRI})
+	ob, err := save(context.Background(), r, vocab.Object{ID: obIRI})
 	if err != nil {
 		t.Errorf("unable to save item %s: %s", obIRI, err)
 	}
@@ -207,7 +301,7 @@ func withCollectionHavingItems(t *testing.T, r *repo) *repo {
 		t.Errorf("unable to save collection %s: %s", colIRI, err)
 	}
 	obIRI := vocab.IRI("https://example.com")
-	ob, err := save(r, vocab.Object{ID: obIRI})
+	ob, err := save(context.Background(), r, vocab.Object{ID: obIRI})
 	if err != nil {
 		t.Errorf("unable to save item %s: %s", obIRI, err)
 	}
@@ -220,7 +314,7 @@ func withCollectionHavingItems(t *testing.T, r *repo) *repo {
 func withItems(items ...vocab.Item) initFn {
 	return func(t *testing.T, r *repo) *repo {
 		for _, it := range items {
-			if _, err := save(r, it); err != nil {
+			if _, err := save(context.Background(), r, it); err != nil {
 				t.Errorf("unable to save item %s: %s", it.GetLink(), err)
 			}
 		}
@@ -491,6 +585,70 @@ func Test_repo_AddTo(t *testing.T) {
 	}
 }
 
+func Test_repo_AddToCollection(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/followers")
+	existing := vocab.Object{ID: "https://example.com"}
+	other := &vocab.Object{ID: "https://example.com/other", Type: vocab.NoteType}
+
+	tests := []struct {
+		name      string
+		items     vocab.ItemCollection
+		wantAdded vocab.ItemCollection
+		wantTotal uint
+	}{
+		{
+			name:      "redelivered item is skipped",
+			items:     vocab.ItemCollection{existing},
+			wantAdded: vocab.ItemCollection{},
+			wantTotal: 1,
+		},
+		{
+			name:      "new item is added",
+			items:     vocab.ItemCollection{other},
+			wantAdded: vocab.ItemCollection{other},
+			wantTotal: 2,
+		},
+		{
+			name:      "mixed new and existing items",
+			items:     vocab.ItemCollection{existing, other, other.GetLink()},
+			wantAdded: vocab.ItemCollection{other},
+			wantTotal: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withOrderedCollectionHavingItems, withItems(other))
+			t.Cleanup(r.Close)
+
+			added, err := r.AddToCollection(colIRI, tt.items...)
+			if err != nil {
+				t.Fatalf("AddToCollection() error = %s", err)
+			}
+			if !cmp.Equal(added, tt.wantAdded, EquateItemCollections) {
+				t.Errorf("AddToCollection() added = %s", cmp.Diff(tt.wantAdded, added, EquateItemCollections))
+			}
+			// NOTE: adding the same items again doesn't change the collection
+			if again, _ := r.AddToCollection(colIRI, tt.items...); len(again) > 0 {
+				t.Errorf("AddToCollection() second call added %d items, want 0", len(again))
+			}
+
+			col, err := r.Load(colIRI)
+			if err != nil {
+				t.Fatalf("Load() after AddToCollection() error = %s", err)
+			}
+			_ = vocab.OnOrderedCollection(col, func(c *vocab.OrderedCollection) error {
+				if c.TotalItems != tt.wantTotal {
+					t.Errorf("TotalItems after AddToCollection() = %d, want %d", c.TotalItems, tt.wantTotal)
+				}
+				if uint(len(c.OrderedItems)) != tt.wantTotal {
+					t.Errorf("Load() after AddToCollection() returned %d items, want %d", len(c.OrderedItems), tt.wantTotal)
+				}
+				return nil
+			})
+		})
+	}
+}
+
 func Test_repo_Load_UnhappyPath(t *testing.T) {
 	type args struct {
 		iri vocab.IRI
@@ -808,3 +966,134 @@ func Test_repo_Delete(t *testing.T) {
 		})
 	}
 }
+
+// countdownCtx is a context which gets canceled after its Err method has been called n times,
+// which allows stopping an operation after a known number of cursor steps.
+type countdownCtx struct {
+	context.Context
+	n int
+}
+
+func (c *countdownCtx) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func mockNotes(count int) vocab.ItemCollection {
+	notes := make(vocab.ItemCollection, 0, count)
+	for i := range count {
+		notes = append(notes, &vocab.Object{ID: vocab.IRI(fmt.Sprintf("https://example.com/objects/%d", i)), Type: vocab.NoteType})
+	}
+	return notes
+}
+
+func withNotesInCollection(colIRI vocab.IRI, count int) initFn {
+	return func(t *testing.T, r *repo) *repo {
+		for _, it := range mockNotes(count) {
+			if _, err := r.Save(it); err != nil {
+				t.Errorf("unable to save item %s: %s", it.GetLink(), err)
+			}
+			if err := r.AddTo(colIRI, it.GetLink()); err != nil {
+				t.Errorf("unable to add item to collection %s -> %s : %s", it.GetLink(), colIRI, err)
+			}
+		}
+		return r
+	}
+}
+
+func Test_repo_LoadCtx(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantCount int
+		wantErr   error
+	}{
+		{
+			name:      "not canceled",
+			ctx:       context.Background(),
+			wantCount: 10,
+		},
+		{
+			name:    "canceled",
+			ctx:     canceled,
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "canceled while iterating",
+			ctx:     &countdownCtx{Context: context.Background(), n: 5},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI), withNotesInCollection(colIRI, 10))
+			t.Cleanup(r.Close)
+
+			got, err := r.LoadCtx(tt.ctx, colIRI)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoadCtx() error = %v, want %v", err, tt.wantErr)
+			}
+			if cnt := itemCount(got); cnt != tt.wantCount {
+				t.Errorf("LoadCtx() returned %d items, want %d", cnt, tt.wantCount)
+			}
+		})
+	}
+}
+
+func Test_repo_AddToCtx(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/outbox")
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withOrderedCollection(colIRI))
+	t.Cleanup(r.Close)
+
+	notes := mockNotes(10)
+	for _, it := range notes {
+		if _, err := r.Save(it); err != nil {
+			t.Fatalf("Save() error = %s", err)
+		}
+	}
+	// NOTE: the context gets canceled after the first items have been added,
+	// so the whole transaction must be rolled back
+	ctx := &countdownCtx{Context: context.Background(), n: 5}
+	if err := r.AddToCtx(ctx, colIRI, notes...); !errors.Is(err, context.Canceled) {
+		t.Fatalf("AddToCtx() error = %v, want %v", err, context.Canceled)
+	}
+	col, err := r.Load(colIRI)
+	if err != nil {
+		t.Fatalf("Load() error = %s", err)
+	}
+	if cnt := itemCount(col); cnt != 0 {
+		t.Errorf("AddToCtx() kept %d items added before the cancellation", cnt)
+	}
+
+	if err = r.AddToCtx(context.Background(), colIRI, notes...); err != nil {
+		t.Fatalf("AddToCtx() error = %s", err)
+	}
+	if col, err = r.Load(colIRI); err != nil {
+		t.Fatalf("Load() error = %s", err)
+	}
+	if cnt := itemCount(col); cnt != len(notes) {
+		t.Errorf("AddToCtx() added %d items, want %d", cnt, len(notes))
+	}
+}
+
+func Test_repo_SaveCtx(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap)
+	t.Cleanup(r.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	note := &vocab.Object{ID: "https://example.com/objects/1", Type: vocab.NoteType}
+	if _, err := r.SaveCtx(ctx, note); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SaveCtx() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := r.Load(note.ID); !errors.IsNotFound(err) {
+		t.Errorf("Load() after canceled SaveCtx() error = %v, want not found", err)
+	}
+}
@@ -1,6 +1,7 @@
 package boltdb
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -149,7 +150,7 @@ var (
 
 func withMockItems(t *testing.T, r *repo) *repo {
 	for _, it := range mockItems {
-		if _, err := save(r, it); err != nil {
+		if _, err := save(context.Background(), r, it); err != nil {
 			t.Errorf("unable to save item: %s: %s", it.GetLink(), err)
 		}
 	}
@@ -282,7 +283,7 @@ func withGeneratedRoot(root vocab.Item) initFn {
 func withGeneratedItems(items vocab.ItemCollection) initFn {
 	return func(t *testing.T, r *repo) *repo {
 		for _, it := range items {
-			if _, err := save(r, it); err != nil {
+			if _, err := save(context.Background(), r, it); err != nil {
 				t.Errorf("unable to save %T[%s]: %s", it, it.GetLink(), err)
 			}
 		}
@@ -0,0 +1,73 @@
+package boltdb
+
+import (
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeleteMode selects what Delete does with the stored objects.
+type DeleteMode uint8
+
+const (
+	// DeleteHard removes the object bucket, together with all its child collections.
+	DeleteHard DeleteMode = iota
+	// DeleteTombstone replaces the object with a Tombstone which keeps the object's former type
+	// and the time of the deletion. The child collections of the object are kept.
+	DeleteTombstone
+)
+
+func isTombstone(it vocab.Item) bool {
+	return !vocab.IsNil(it) && vocab.ActivityVocabularyTypes{vocab.TombstoneType}.Match(it.GetType())
+}
+
+func tombstoneFor(it vocab.Item, deleted time.Time) *vocab.Tombstone {
+	t := &vocab.Tombstone{
+		ID:      it.GetID(),
+		Type:    vocab.TombstoneType,
+		Deleted: deleted,
+	}
+	if types := typesOf(it.GetType()); len(types) > 0 {
+		t.FormerType = vocab.ActivityVocabularyType(types[0])
+	}
+	return t
+}
+
+// tombstoneInBucket replaces the object stored in the bucket at path with its Tombstone.
+// It returns false if there's no object which can be replaced, in which case the caller should fall back to
+// removing the bucket.
+func (r *repo) tombstoneInBucket(root *bolt.Bucket, path []byte) (bool, error) {
+	b, remainder, err := descendInBucket(root, path, false)
+	if err != nil || len(remainder) > 0 {
+		return false, nil
+	}
+	it, err := r.loadRawItemFromBucket(b)
+	if err != nil || vocab.IsCollection(it) {
+		return false, nil
+	}
+	if isTombstone(it) {
+		return true, nil
+	}
+	t := tombstoneFor(it, time.Now().UTC().Truncate(time.Second))
+	if err = indexItem(root, t); err != nil {
+		return true, errors.Annotatef(err, "could not index %s", t.GetLink())
+	}
+	if err = r.saveRevision(b, t); err != nil {
+		return true, errors.Annotatef(err, "could not save previous version of %s", t.GetLink())
+	}
+	return true, r.saveRawItem(t, b)
+}
+
+// ExcludeTombstones returns a check which doesn't match the objects that have been replaced by a Tombstone.
+func ExcludeTombstones() filters.Check {
+	return notTombstone{}
+}
+
+type notTombstone struct{}
+
+func (notTombstone) Match(it vocab.Item) bool {
+	return !isTombstone(it)
+}
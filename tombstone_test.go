@@ -0,0 +1,81 @@
+package boltdb
+
+import (
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_tombstoneFor(t *testing.T) {
+	deleted := time.Now().UTC().Truncate(time.Second)
+	tests := []struct {
+		name string
+		it   vocab.Item
+		want *vocab.Tombstone
+	}{
+		{
+			name: "note",
+			it:   &vocab.Object{ID: "https://example.com/1", Type: vocab.NoteType, Published: publishedTime},
+			want: &vocab.Tombstone{ID: "https://example.com/1", Type: vocab.TombstoneType, FormerType: vocab.NoteType, Deleted: deleted},
+		},
+		{
+			name: "actor",
+			it:   &vocab.Actor{ID: "https://example.com/~jdoe", Type: vocab.PersonType},
+			want: &vocab.Tombstone{ID: "https://example.com/~jdoe", Type: vocab.TombstoneType, FormerType: vocab.PersonType, Deleted: deleted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tombstoneFor(tt.it, deleted); !cmp.Equal(got, tt.want) {
+				t.Errorf("tombstoneFor() = %s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func Test_repo_Delete_Tombstone(t *testing.T) {
+	colIRI := vocab.IRI("https://example.com/~jdoe/outbox")
+	note := &vocab.Object{ID: "https://example.com/objects/2", Type: vocab.NoteType}
+
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withItems(note), withMembership(note, colIRI))
+	t.Cleanup(r.Close)
+	r.deleteMode = DeleteTombstone
+
+	if err := r.Delete(note); err != nil {
+		t.Fatalf("Delete() error = %s", err)
+	}
+	it, err := r.Load(note.ID)
+	if err != nil {
+		t.Fatalf("Load() after Delete() error = %s", err)
+	}
+	if !isTombstone(it) {
+		t.Fatalf("Load() after Delete() returned %s, expected a %s", it.GetType(), vocab.TombstoneType)
+	}
+	_ = vocab.OnTombstone(it, func(tomb *vocab.Tombstone) error {
+		if tomb.FormerType != vocab.NoteType {
+			t.Errorf("Tombstone FormerType = %v, want %s", tomb.FormerType, vocab.NoteType)
+		}
+		if tomb.Deleted.IsZero() {
+			t.Errorf("Tombstone Deleted is not set")
+		}
+		return nil
+	})
+
+	// NOTE: a second delete keeps the existing tombstone
+	if err = r.Delete(note); err != nil {
+		t.Errorf("Delete() of a tombstone error = %s", err)
+	}
+
+	col, err := r.Load(colIRI, ExcludeTombstones())
+	if err != nil {
+		t.Fatalf("Load() of collection error = %s", err)
+	}
+	_ = vocab.OnCollectionIntf(col, func(c vocab.CollectionInterface) error {
+		if c.Contains(note.ID) {
+			t.Errorf("Load() with ExcludeTombstones() still returned %s", note.ID)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+package boltdb
+
+import (
+	"context"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Tx exposes the repository operations running on a single bolt transaction.
+// All the changes made through a Tx are committed together, or not at all.
+type Tx interface {
+	Load(vocab.IRI, ...filters.Check) (vocab.Item, error)
+	Save(vocab.Item) (vocab.Item, error)
+	AddTo(vocab.IRI, ...vocab.Item) error
+	AddToCollection(vocab.IRI, ...vocab.Item) (vocab.ItemCollection, error)
+	RemoveFrom(vocab.IRI, ...vocab.Item) error
+	Delete(vocab.Item) error
+	ContainedIn(vocab.IRI) ([]vocab.IRI, error)
+	LoadMetadata(vocab.IRI, any) error
+	SaveMetadata(vocab.IRI, any) error
+}
+
+var errReadOnlyTx = errors.MethodNotAllowedf("transaction is read-only")
+
+type repoTx struct {
+	ctx context.Context
+	r   *repo
+	tx  *bolt.Tx
+}
+
+// Tx runs fn in a read-write transaction.
+// The transaction is committed if fn returns nil, and rolled back if it returns an error or panics.
+func (r *repo) Tx(fn func(Tx) error) error {
+	return r.TxCtx(context.Background(), fn)
+}
+
+// TxCtx is Tx, which rolls back the transaction if ctx is done before fn finishes.
+// The operations of the Tx received by fn stop, returning ctx.Err(), when ctx is done.
+func (r *repo) TxCtx(ctx context.Context, fn func(Tx) error) error {
+	if r == nil || r.d == nil {
+		return errNotOpen
+	}
+	if fn == nil {
+		return nil
+	}
+	return r.updateCtx(ctx, func(tx *bolt.Tx) error {
+		return fn(&repoTx{ctx: ctx, r: r, tx: tx})
+	})
+}
+
+// View runs fn in a read-only transaction.
+// The write operations of the Tx received by fn return an error.
+func (r *repo) View(fn func(Tx) error) error {
+	return r.ViewCtx(context.Background(), fn)
+}
+
+// ViewCtx is View, where the operations of the Tx received by fn stop, returning ctx.Err(), when ctx is done.
+func (r *repo) ViewCtx(ctx context.Context, fn func(Tx) error) error {
+	if r == nil || r.d == nil {
+		return errNotOpen
+	}
+	if fn == nil {
+		return nil
+	}
+	return r.view(ctx, func(tx *bolt.Tx) error {
+		return fn(&repoTx{ctx: ctx, r: r, tx: tx})
+	})
+}
+
+func (t *repoTx) writable() error {
+	if !t.tx.Writable() {
+		return errReadOnlyTx
+	}
+	return nil
+}
+
+// Load
+func (t *repoTx) Load(iri vocab.IRI, fil ...filters.Check) (vocab.Item, error) {
+	return t.r.loadTx(t.ctx, t.tx, iri, fil...)
+}
+
+// Save
+func (t *repoTx) Save(it vocab.Item) (vocab.Item, error) {
+	if err := t.writable(); err != nil {
+		return nil, err
+	}
+	if vocab.IsNil(it) {
+		return nil, errors.Newf("Unable to save nil element")
+	}
+	if err := saveTx(t.r, t.tx, it); err != nil {
+		return it, err
+	}
+	return it, nil
+}
+
+// AddTo
+func (t *repoTx) AddTo(colIRI vocab.IRI, items ...vocab.Item) error {
+	_, err := t.AddToCollection(colIRI, items...)
+	return err
+}
+
+// AddToCollection
+func (t *repoTx) AddToCollection(colIRI vocab.IRI, items ...vocab.Item) (vocab.ItemCollection, error) {
+	if err := t.writable(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return t.r.addToTx(t.ctx, t.tx, colIRI, items...)
+}
+
+// RemoveFrom
+func (t *repoTx) RemoveFrom(colIRI vocab.IRI, items ...vocab.Item) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	return t.r.removeFromTx(t.ctx, t.tx, colIRI, items...)
+}
+
+// Delete
+func (t *repoTx) Delete(it vocab.Item) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	if vocab.IsNil(it) {
+		return nil
+	}
+	return delete(t.ctx, t.r, t.tx, it)
+}
+
+// ContainedIn
+func (t *repoTx) ContainedIn(iri vocab.IRI) ([]vocab.IRI, error) {
+	return t.r.containedInTx(t.tx, iri)
+}
+
+// LoadMetadata
+func (t *repoTx) LoadMetadata(iri vocab.IRI, m any) error {
+	return t.r.loadMetadataTx(t.tx, iri, m)
+}
+
+// SaveMetadata
+func (t *repoTx) SaveMetadata(iri vocab.IRI, m any) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.Newf("Could not save nil metadata")
+	}
+	return t.r.saveMetadataTx(t.tx, iri, m)
+}
@@ -0,0 +1,129 @@
+package boltdb
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_repo_Tx(t *testing.T) {
+	note := &vocab.Object{ID: "https://example.com/objects/tx", Type: vocab.NoteType}
+	colIRI := vocab.IRI("https://example.com/~jdoe/outbox")
+	errAbort := errors.Newf("abort")
+
+	tests := []struct {
+		name     string
+		fields   fields
+		setupFns []initFn
+		fn       func(Tx) error
+		wantErr  error
+		wantSave bool
+	}{
+		{
+			name:    "empty",
+			fields:  fields{},
+			wantErr: errNotOpen,
+		},
+		{
+			name:     "commit",
+			fields:   fields{path: t.TempDir()},
+			setupFns: []initFn{withOpenRoot, withBootstrap, withOrderedCollection(colIRI)},
+			fn: func(tx Tx) error {
+				if _, err := tx.Save(note); err != nil {
+					return err
+				}
+				if err := tx.AddTo(colIRI, note); err != nil {
+					return err
+				}
+				return tx.SaveMetadata(note.ID, &Metadata{Pw: defaultPw})
+			},
+			wantSave: true,
+		},
+		{
+			name:     "rollback on error",
+			fields:   fields{path: t.TempDir()},
+			setupFns: []initFn{withOpenRoot, withBootstrap, withOrderedCollection(colIRI)},
+			fn: func(tx Tx) error {
+				if _, err := tx.Save(note); err != nil {
+					return err
+				}
+				if err := tx.AddTo(colIRI, note); err != nil {
+					return err
+				}
+				return errAbort
+			},
+			wantErr: errAbort,
+		},
+		{
+			name:     "changes are visible inside the transaction",
+			fields:   fields{path: t.TempDir()},
+			setupFns: []initFn{withOpenRoot, withBootstrap},
+			fn: func(tx Tx) error {
+				if _, err := tx.Save(note); err != nil {
+					return err
+				}
+				it, err := tx.Load(note.ID)
+				if err != nil {
+					return err
+				}
+				if !cmp.Equal(it, vocab.Item(note)) {
+					t.Errorf("Load() inside Tx = %s", cmp.Diff(note, it))
+				}
+				return nil
+			},
+			wantSave: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mockRepo(t, tt.fields, tt.setupFns...)
+			t.Cleanup(r.Close)
+
+			err := r.Tx(tt.fn)
+			if !cmp.Equal(err, tt.wantErr, EquateWeakErrors) {
+				t.Errorf("Tx() error = %s", cmp.Diff(tt.wantErr, err, EquateWeakErrors))
+			}
+			if tt.fields.path == "" {
+				return
+			}
+			_, err = r.Load(note.ID)
+			if tt.wantSave && err != nil {
+				t.Errorf("Load() after Tx() error = %s", err)
+			}
+			if !tt.wantSave && !errors.IsNotFound(err) {
+				t.Errorf("Load() after rolled back Tx() error = %v, expected not found", err)
+			}
+		})
+	}
+}
+
+func Test_repo_View(t *testing.T) {
+	r := mockRepo(t, fields{path: t.TempDir()}, withOpenRoot, withBootstrap, withMockItems, withMetadataJDoe)
+	t.Cleanup(r.Close)
+
+	err := r.View(func(tx Tx) error {
+		it, err := tx.Load("https://example.com/~jdoe")
+		if err != nil {
+			return err
+		}
+		if it.GetLink() != "https://example.com/~jdoe" {
+			t.Errorf("Load() inside View = %s", it.GetLink())
+		}
+		m := new(Metadata)
+		if err = tx.LoadMetadata("https://example.com/~jdoe", m); err != nil {
+			return err
+		}
+		if _, err = tx.Save(&vocab.Object{ID: "https://example.com/objects/view"}); !errors.Is(err, errReadOnlyTx) {
+			t.Errorf("Save() inside View error = %v, want %s", err, errReadOnlyTx)
+		}
+		if err = tx.Delete(it); !errors.Is(err, errReadOnlyTx) {
+			t.Errorf("Delete() inside View error = %v, want %s", err, errReadOnlyTx)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("View() error = %s", err)
+	}
+}